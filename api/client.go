@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+
+	"github.com/gorilla/websocket"
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/core"
+	"github.com/prism/gem/utils"
+)
+
+// ErrDaemonNotRunning is returned when no Gem daemon is listening on the socket
+var ErrDaemonNotRunning = errors.New("gem daemon is not running, start it with 'gem daemon'")
+
+// Client talks to a running Gem daemon over its Unix socket
+type Client struct {
+	socketPath string
+	httpClient *http.Client
+}
+
+// NewClient creates a new client for the daemon listening on socketPath
+func NewClient(socketPath string) *Client {
+	return &Client{
+		socketPath: socketPath,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Ping checks that the daemon is reachable
+func (c *Client) Ping() error {
+	return c.do(http.MethodGet, "/health", nil, nil)
+}
+
+// ListProcesses returns all processes managed by the daemon
+func (c *Client) ListProcesses() ([]*core.ManagedProcess, error) {
+	var processes []*core.ManagedProcess
+	if err := c.do(http.MethodGet, "/api/v1/processes", nil, &processes); err != nil {
+		return nil, err
+	}
+	return processes, nil
+}
+
+// StartProcess asks the daemon to start a process
+func (c *Client) StartProcess(procConfig *config.ProcessConfig) (*core.ManagedProcess, error) {
+	var proc core.ManagedProcess
+	if err := c.do(http.MethodPost, "/api/v1/processes", procConfig, &proc); err != nil {
+		return nil, err
+	}
+	return &proc, nil
+}
+
+// StopProcess asks the daemon to stop a process
+func (c *Client) StopProcess(name string, force bool) error {
+	path := fmt.Sprintf("/api/v1/processes/%s?force=%t", url.PathEscape(name), force)
+	return c.do(http.MethodDelete, path, nil, nil)
+}
+
+// RestartProcess asks the daemon to restart a process
+func (c *Client) RestartProcess(name string) error {
+	path := fmt.Sprintf("/api/v1/processes/%s/restart", url.PathEscape(name))
+	return c.do(http.MethodPost, path, nil, nil)
+}
+
+// GetProcessInfo returns detailed information about a process
+func (c *Client) GetProcessInfo(name string) (*utils.ProcessInfo, error) {
+	var info utils.ProcessInfo
+	path := fmt.Sprintf("/api/v1/processes/%s", url.PathEscape(name))
+	if err := c.do(http.MethodGet, path, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetLogs returns the last lines of a process log stream
+func (c *Client) GetLogs(name string, stream string, lines int) ([]string, error) {
+	var resp struct {
+		Logs []string `json:"logs"`
+	}
+	path := fmt.Sprintf("/api/v1/processes/%s/logs/%s?lines=%s", url.PathEscape(name), url.PathEscape(stream), strconv.Itoa(lines))
+	if err := c.do(http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Logs, nil
+}
+
+// SignalProcess asks the daemon to send a signal, given by name or number, to a process
+func (c *Client) SignalProcess(name string, signal string) error {
+	path := fmt.Sprintf("/api/v1/processes/%s/signal", url.PathEscape(name))
+	return c.do(http.MethodPost, path, map[string]string{"signal": signal}, nil)
+}
+
+// ReloadProcess asks the daemon to send a process its reload signal
+func (c *Client) ReloadProcess(name string) error {
+	path := fmt.Sprintf("/api/v1/processes/%s/reload", url.PathEscape(name))
+	return c.do(http.MethodPost, path, nil, nil)
+}
+
+// ReloadConfig asks the daemon to re-read config.yaml and the process definitions
+func (c *Client) ReloadConfig() (*core.ReloadResult, error) {
+	var result core.ReloadResult
+	if err := c.do(http.MethodPost, "/api/v1/reload-config", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// StreamEvents calls fn for every lifecycle event the daemon publishes, or
+// only those of process when it isn't empty, until fn returns an error or the
+// connection is closed
+func (c *Client) StreamEvents(process string, fn func(event core.Event) error) error {
+	path := "/api/v1/events"
+	if process != "" {
+		path += "?process=" + url.QueryEscape(process)
+	}
+
+	resp, err := c.httpClient.Get("http://gem" + path)
+	if err != nil {
+		return mapDialError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("daemon returned %s", resp.Status)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event core.Event
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
+
+// ShellResize is the control message that sets the terminal size of an
+// attached shell. It is sent as a text message, anything else is input.
+type ShellResize struct {
+	Type string `json:"type"` // Always "resize"
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// ResizeShell tells the shell on conn the size of the terminal it is attached to
+func ResizeShell(conn *websocket.Conn, rows, cols uint16) error {
+	return conn.WriteJSON(ShellResize{Type: "resize", Rows: rows, Cols: cols})
+}
+
+// AttachShell opens a websocket to an interactive shell for a process
+func (c *Client) AttachShell(name string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", c.socketPath)
+		},
+	}
+
+	wsURL := fmt.Sprintf("ws://gem/api/v1/processes/%s/shell", url.PathEscape(name))
+	conn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, mapDialError(err)
+	}
+	return conn, nil
+}
+
+// do sends a request to the daemon and decodes the JSON response into out
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, "http://gem"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return mapDialError(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// Surface the daemon's error message
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("daemon returned %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// mapDialError turns connection failures into ErrDaemonNotRunning
+func mapDialError(err error) error {
+	if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrDaemonNotRunning
+	}
+	return err
+}
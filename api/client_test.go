@@ -0,0 +1,117 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientDaemonNotRunning(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-api-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	client := NewClient(filepath.Join(tempDir, "gem.sock"))
+	_, err = client.ListProcesses()
+	assert.ErrorIs(t, err, ErrDaemonNotRunning)
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-api-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Start a daemon on a temporary socket
+	socketPath := filepath.Join(tempDir, "gem.sock")
+	store, err := core.OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	pm := core.NewProcessManager(store, filepath.Join(tempDir, "logs"))
+	server := NewAPIServer(pm)
+	go server.StartUnix(socketPath)
+
+	client := NewClient(socketPath)
+	assert.Eventually(t, func() bool { return client.Ping() == nil }, 2*time.Second, 10*time.Millisecond)
+
+	// Only the owner may use the socket, and nothing is left next to it
+	stat, err := os.Stat(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	entries, err := os.ReadDir(tempDir)
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".gem-socket-")
+	}
+
+	// Start a process through the client
+	proc, err := client.StartProcess(&config.ProcessConfig{
+		Name:    "test-process",
+		Command: "sleep",
+		Args:    []string{"10"},
+	})
+	assert.NoError(t, err)
+	assert.Greater(t, proc.PID, 0)
+
+	// The daemon reports it
+	processes, err := client.ListProcesses()
+	assert.NoError(t, err)
+	assert.Len(t, processes, 1)
+
+	info, err := client.GetProcessInfo("test-process")
+	assert.NoError(t, err)
+	assert.Equal(t, "test-process", info.Name)
+	assert.Equal(t, int32(proc.PID), info.PID)
+
+	// Errors from the daemon are passed through
+	_, err = client.GetProcessInfo("missing")
+	assert.EqualError(t, err, "process missing not found")
+
+	// Signals are passed by name
+	assert.NoError(t, client.SignalProcess("test-process", "CONT"))
+	assert.EqualError(t, client.SignalProcess("test-process", "NOPE"), `unknown signal "NOPE"`)
+
+	// The shell takes the size of the terminal it is attached to
+	conn, err := client.AttachShell("test-process")
+	assert.NoError(t, err)
+	assert.NoError(t, ResizeShell(conn, 40, 100))
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("stty size; exit\n")))
+	var output string
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		output += string(data)
+	}
+	conn.Close()
+	assert.Contains(t, output, "40 100")
+
+	// A second daemon refuses to share the socket
+	assert.Error(t, NewAPIServer(pm).StartUnix(socketPath))
+
+	// Watch the lifecycle events of the process
+	events := make(chan core.Event, 10)
+	go client.StreamEvents("test-process", func(event core.Event) error {
+		events <- event
+		return nil
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	// Stop the process
+	assert.NoError(t, client.StopProcess("test-process", true))
+
+	select {
+	case event := <-events:
+		assert.Equal(t, core.EventExited, event.Type)
+		assert.Equal(t, "SIGKILL", event.Signal)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event streamed")
+	}
+}
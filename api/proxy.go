@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartProxy exposes the daemon's API on a TCP address by proxying to its Unix
+// socket. The API has no authentication, so host should be a loopback address
+// unless every client that can reach it is trusted.
+func StartProxy(host string, port int, socketPath string) error {
+	client := NewClient(socketPath)
+
+	// Make sure there is a daemon to talk to
+	if err := client.Ping(); err != nil {
+		return err
+	}
+
+	target, _ := url.Parse("http://gem")
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = client.httpClient.Transport
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		logrus.Warnf("The API on %s has no authentication, anyone who can reach it controls the daemon", host)
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	logrus.Infof("Starting API server on %s (daemon socket: %s)", addr, socketPath)
+	return http.ListenAndServe(addr, proxy)
+}
@@ -1,15 +1,21 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
+	"github.com/creack/pty"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/prism/gem/config"
 	"github.com/prism/gem/core"
+	"github.com/prism/gem/utils"
 	"github.com/sirupsen/logrus"
 )
 
@@ -52,6 +58,53 @@ func (s *APIServer) Start(port int) error {
 	return s.router.Run(addr)
 }
 
+// StartUnix starts the API server on a Unix socket
+func (s *APIServer) StartUnix(socketPath string) error {
+	// Refuse to take over a socket another daemon is still serving
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("a Gem daemon is already listening on %s", socketPath)
+	}
+
+	// Remove a stale socket left behind by a previous daemon
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Only the owner may control the daemon. The socket is created in a
+	// directory no one else can enter and only moved into place once it is
+	// private, so no one can connect before.
+	dir, err := os.MkdirTemp(filepath.Dir(socketPath), ".gem-socket-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	privatePath := filepath.Join(dir, filepath.Base(socketPath))
+	listener, err := net.Listen("unix", privatePath)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(privatePath, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+	if err := os.Rename(privatePath, socketPath); err != nil {
+		listener.Close()
+		return err
+	}
+	defer os.Remove(socketPath)
+	os.Remove(dir)
+
+	logrus.Infof("Starting API server on %s", socketPath)
+	return s.Serve(listener)
+}
+
+// Serve serves the API on an existing listener
+func (s *APIServer) Serve(listener net.Listener) error {
+	return http.Serve(listener, s.router)
+}
+
 // setupRoutes sets up the API routes
 func (s *APIServer) setupRoutes() {
 	// API version
@@ -65,6 +118,8 @@ func (s *APIServer) setupRoutes() {
 		processes.GET("/:name", s.getProcess)
 		processes.DELETE("/:name", s.stopProcess)
 		processes.POST("/:name/restart", s.restartProcess)
+		processes.POST("/:name/signal", s.signalProcess)
+		processes.POST("/:name/reload", s.reloadProcess)
 		processes.GET("/:name/logs/:stream", s.getLogs)
 		processes.GET("/:name/shell", s.shellWebsocket)
 	}
@@ -76,6 +131,12 @@ func (s *APIServer) setupRoutes() {
 		clusters.GET("/:name", s.getCluster)
 	}
 
+	// Lifecycle events
+	v1.GET("/events", s.streamEvents)
+
+	// Configuration
+	v1.POST("/reload-config", s.reloadConfig)
+
 	// System information
 	v1.GET("/system", s.getSystemInfo)
 
@@ -95,7 +156,7 @@ func (s *APIServer) listProcesses(c *gin.Context) {
 	filteredProcesses := make([]*core.ManagedProcess, 0)
 	for _, proc := range processes {
 		if !isClusterWorker(proc.Config.Name) {
-			filteredProcesses = append(filteredProcesses, proc)
+			filteredProcesses = append(filteredProcesses, proc.Snapshot())
 		}
 	}
 	
@@ -116,7 +177,7 @@ func (s *APIServer) startProcess(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, proc)
+	c.JSON(http.StatusCreated, proc.Snapshot())
 }
 
 // getProcess gets information about a process
@@ -157,6 +218,43 @@ func (s *APIServer) restartProcess(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "restarting"})
 }
 
+// signalProcess sends a signal to a process
+func (s *APIServer) signalProcess(c *gin.Context) {
+	name := c.Param("name")
+
+	var request struct {
+		Signal string `json:"signal"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sig, err := utils.ParseSignal(request.Signal)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.processManager.SignalProcess(name, sig); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "signalled"})
+}
+
+// reloadProcess sends a process its reload signal
+func (s *APIServer) reloadProcess(c *gin.Context) {
+	name := c.Param("name")
+
+	if err := s.processManager.ReloadProcess(name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "reloading"})
+}
+
 // getLogs gets logs for a process
 func (s *APIServer) getLogs(c *gin.Context) {
 	name := c.Param("name")
@@ -181,6 +279,47 @@ func (s *APIServer) getLogs(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"logs": logs})
 }
 
+// streamEvents streams lifecycle events as newline delimited JSON until the
+// client disconnects, optionally only those of one process
+func (s *APIServer) streamEvents(c *gin.Context) {
+	process := c.Query("process")
+
+	sub := s.processManager.Events().Subscribe(0)
+	defer sub.Close()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	encoder := json.NewEncoder(c.Writer)
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-sub.Events():
+			if process != "" && event.Process != process {
+				continue
+			}
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// reloadConfig re-reads config.yaml and the process definitions
+func (s *APIServer) reloadConfig(c *gin.Context) {
+	result, err := s.processManager.ReloadConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result.LogSummary()
+	c.JSON(http.StatusOK, result)
+}
+
 // shellWebsocket handles shell access via websocket
 func (s *APIServer) shellWebsocket(c *gin.Context) {
 	name := c.Param("name")
@@ -194,7 +333,7 @@ func (s *APIServer) shellWebsocket(c *gin.Context) {
 	defer ws.Close()
 	
 	// Attach shell to process
-	pty, err := s.processManager.AttachShell(name)
+	ptmx, err := s.processManager.AttachShell(name)
 	if err != nil {
 		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error: %v", err)))
 		return
@@ -203,9 +342,12 @@ func (s *APIServer) shellWebsocket(c *gin.Context) {
 	
 	// Set up bidirectional communication
 	go func() {
+		// Closing the websocket ends the read loop below once the shell exits
+		defer ws.Close()
+
 		buf := make([]byte, 1024)
 		for {
-			n, err := pty.Read(buf)
+			n, err := ptmx.Read(buf)
 			if err != nil {
 				break
 			}
@@ -221,8 +363,18 @@ func (s *APIServer) shellWebsocket(c *gin.Context) {
 		if err != nil {
 			break
 		}
+		if messageType == websocket.TextMessage {
+			// Resize the pty to the terminal on the other end
+			var resize ShellResize
+			if json.Unmarshal(p, &resize) == nil && resize.Type == "resize" {
+				if err := pty.Setsize(ptmx, &pty.Winsize{Rows: resize.Rows, Cols: resize.Cols}); err != nil {
+					logrus.Warnf("Failed to resize pty: %v", err)
+				}
+				continue
+			}
+		}
 		if messageType == websocket.TextMessage || messageType == websocket.BinaryMessage {
-			if _, err := pty.Write(p); err != nil {
+			if _, err := ptmx.Write(p); err != nil {
 				break
 			}
 		}
@@ -237,7 +389,7 @@ func (s *APIServer) listClusters(c *gin.Context) {
 	clusters := make([]*core.ManagedProcess, 0)
 	for _, proc := range processes {
 		if len(proc.ClusterProcs) > 0 {
-			clusters = append(clusters, proc)
+			clusters = append(clusters, proc.Snapshot())
 		}
 	}
 	
@@ -259,7 +411,7 @@ func (s *APIServer) getCluster(c *gin.Context) {
 		return
 	}
 	
-	c.JSON(http.StatusOK, proc)
+	c.JSON(http.StatusOK, proc.Snapshot())
 }
 
 // getSystemInfo gets system information
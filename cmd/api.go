@@ -9,6 +9,7 @@ import (
 
 var (
 	// API command flags
+	apiHostFlag string
 	apiPortFlag int
 
 	// API command
@@ -21,6 +22,7 @@ var (
 )
 
 func init() {
+	apiCmd.Flags().StringVar(&apiHostFlag, "host", "127.0.0.1", "Address to listen on, the API has no authentication")
 	apiCmd.Flags().IntVarP(&apiPortFlag, "port", "p", 0, "API server port (default: from config)")
 }
 
@@ -39,12 +41,9 @@ func runAPI(cmd *cobra.Command, args []string) {
 			port = config.GlobalConfig.APIPort
 		}
 
-		// Create API server
-		server := api.NewAPIServer(processManager)
-
-		// Start API server
+		// Serve the daemon's API over TCP
 		logrus.Infof("Starting API server on port %d", port)
-		if err := server.Start(port); err != nil {
+		if err := api.StartProxy(apiHostFlag, port, config.GlobalConfig.SocketPath); err != nil {
 			logrus.Fatalf("Failed to start API server: %v", err)
 		}
 	case "stop":
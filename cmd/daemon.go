@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/prism/gem/api"
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/core"
+	"github.com/prism/gem/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Daemon command
+	daemonCmd = &cobra.Command{
+		Use:   "daemon",
+		Short: "Run the Gem supervisor",
+		Long: `Run the Gem supervisor in the foreground. The daemon owns all managed
+processes, restarts them according to their policies and serves the other
+gem commands over the Unix socket configured as socket_path.`,
+		Run: runDaemon,
+	}
+)
+
+func runDaemon(cmd *cobra.Command, args []string) {
+	// Only one supervisor may own a config directory
+	lock, err := utils.AcquireLock(filepath.Join(configDir, "gem.lock"))
+	if err != nil {
+		logrus.Fatalf("Another Gem daemon is using %s: %v", configDir, err)
+	}
+	defer lock.Release()
+
+	// Refuse a shutdown policy we don't know rather than guess at shutdown
+	policy := config.GlobalConfig.ShutdownPolicy
+	if policy != "stop" && policy != "detach" {
+		logrus.Fatalf("Invalid shutdown_policy %q, must be stop or detach", policy)
+	}
+
+	// Take over the signals before booting, so one that arrives meanwhile
+	// still goes through the shutdown policy or reloads the config
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	// Open the state store, migrating the old processes directory on first use
+	store, err := core.OpenStateStore(config.GlobalConfig.StatePath, config.GlobalConfig.ProcessesPath)
+	if err != nil {
+		logrus.Fatalf("Failed to open state store: %v", err)
+	}
+
+	// Initialize process manager
+	processManager := core.NewProcessManager(store, config.GlobalConfig.LogsPath)
+
+	// Keep track of orphaned descendants of the processes
+	processManager.StartReaper()
+
+	// Run every process in a cgroup of its own
+	processManager.EnableCgroups()
+
+	// Load running processes
+	if err := processManager.LoadRunningProcesses(); err != nil {
+		logrus.Warnf("Failed to load running processes: %v", err)
+	}
+
+	// Serve the CLI on the daemon socket, the processes it can see are known
+	// now and autostart may take a while
+	// The config may be reloaded from here on, the socket stays where it is
+	socketPath := config.GlobalConfig.SocketPath
+	parallelism := config.GlobalConfig.AutoStartParallelism
+	server := api.NewAPIServer(processManager)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.StartUnix(socketPath)
+	}()
+
+	// Start the processes marked autostart that aren't running yet. Waiting
+	// for dependencies can take a while, so signals are handled meanwhile and
+	// a shutdown stops whatever has been started by then.
+	go func() {
+		processManager.AutoStart(parallelism).LogSummary()
+	}()
+
+	// Run until asked to shut down, reloading the config on SIGHUP
+	failed := false
+	for running := true; running; {
+		select {
+		case err := <-serveErr:
+			// The processes are still ours and go by the shutdown policy
+			logrus.Errorf("Failed to serve on %s, shutting down: %v", socketPath, err)
+			failed = true
+			running = false
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				logrus.Info("Received hangup, reloading configuration")
+				go reloadConfig(processManager)
+				continue
+			}
+			logrus.Infof("Received %s, shutting down", sig)
+			running = false
+		}
+	}
+
+	// Apply the shutdown policy
+	switch config.Current().ShutdownPolicy {
+	case "detach":
+		processManager.Detach()
+	default:
+		processManager.StopAll()
+	}
+
+	if failed {
+		// The socket may belong to another daemon, it is left alone
+		lock.Release()
+		os.Exit(1)
+	}
+
+	os.Remove(socketPath)
+	logrus.Info("Gem daemon stopped")
+}
+
+// reloadConfig reloads the configuration and logs the result
+func reloadConfig(processManager *core.ProcessManager) {
+	result, err := processManager.ReloadConfig()
+	if err != nil {
+		logrus.Errorf("Failed to reload configuration: %v", err)
+		return
+	}
+	result.LogSummary()
+}
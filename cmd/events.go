@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prism/gem/core"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Events command flags
+	eventsJSONFlag bool
+
+	// Events command
+	eventsCmd = &cobra.Command{
+		Use:   "events [process-name]",
+		Short: "Watch process lifecycle events",
+		Long:  `Print lifecycle events of all processes, or of one process, as they happen.`,
+		Args:  cobra.MaximumNArgs(1),
+		Run:   runEvents,
+	}
+)
+
+func init() {
+	eventsCmd.Flags().BoolVar(&eventsJSONFlag, "json", false, "print events as JSON lines")
+}
+
+func runEvents(cmd *cobra.Command, args []string) {
+	process := ""
+	if len(args) > 0 {
+		process = args[0]
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	err := client.StreamEvents(process, func(event core.Event) error {
+		if eventsJSONFlag {
+			return encoder.Encode(event)
+		}
+		fmt.Printf("%s  %-20s %-15s %s\n", event.Time.Format("2006-01-02 15:04:05"), event.Process, event.Type, eventDetails(event))
+		return nil
+	})
+	if err != nil {
+		logrus.Fatalf("Failed to watch events: %v", err)
+	}
+}
+
+// eventDetails formats the fields set for an event
+func eventDetails(event core.Event) string {
+	var details []string
+	if event.PID != 0 {
+		details = append(details, fmt.Sprintf("pid=%d", event.PID))
+	}
+	if event.Type == core.EventExited {
+		if event.Signal != "" {
+			details = append(details, "signal="+event.Signal)
+		} else {
+			details = append(details, fmt.Sprintf("code=%d", event.ExitCode))
+		}
+	}
+	if event.Delay != 0 {
+		details = append(details, "delay="+event.Delay.String())
+	}
+	if event.Hook != "" {
+		details = append(details, "hook="+event.Hook)
+	}
+	if event.Health != "" {
+		details = append(details, "health="+event.Health)
+	}
+	if event.Reason != "" {
+		details = append(details, fmt.Sprintf("reason=%q", event.Reason))
+	}
+	if event.Error != "" {
+		details = append(details, fmt.Sprintf("error=%q", event.Error))
+	}
+	return strings.Join(details, " ")
+}
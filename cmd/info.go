@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/olekukonko/tablewriter"
+	"github.com/prism/gem/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -26,13 +29,9 @@ func runInfo(cmd *cobra.Command, args []string) {
 	}
 
 	name := args[0]
-	proc, err := processManager.GetProcess(name)
-	if err != nil {
-		logrus.Fatalf("Failed to get process: %v", err)
-	}
 
 	// Get process info
-	info, err := processManager.GetProcessInfo(name)
+	info, err := client.GetProcessInfo(name)
 	if err != nil {
 		logrus.Fatalf("Failed to get process info: %v", err)
 	}
@@ -40,23 +39,65 @@ func runInfo(cmd *cobra.Command, args []string) {
 	// Print process information
 	fmt.Printf("Process: %s\n", info.Name)
 	fmt.Printf("Status: %s\n", info.Status)
+	if info.StatusText != "" {
+		fmt.Printf("Status Text: %s\n", info.StatusText)
+	}
 	fmt.Printf("PID: %d\n", info.PID)
 	fmt.Printf("CPU: %.1f%%\n", info.CPU)
 	fmt.Printf("Memory: %.1f MB\n", info.Memory)
 	fmt.Printf("Uptime: %s\n", info.Uptime)
-	fmt.Printf("Restarts: %d\n", proc.Restarts)
+	fmt.Printf("Restarts: %d\n", info.Restarts)
+	if info.MemoryRestarts > 0 {
+		fmt.Printf("Memory Restarts: %d\n", info.MemoryRestarts)
+	}
+	if info.LastExitReason != "" {
+		fmt.Printf("Last Exit: %s\n", info.LastExitReason)
+	}
+	if info.Backoff != nil {
+		fmt.Printf("Backoff: attempt %d, delay %s", info.Backoff.Attempt, info.Backoff.Delay)
+		if !info.Backoff.NextRestart.IsZero() {
+			fmt.Printf(", restarting in %s", time.Until(info.Backoff.NextRestart).Round(time.Second))
+		}
+		fmt.Println()
+	}
+	if info.Health != nil {
+		fmt.Printf("Health: %s", info.Health.Status)
+		if info.Health.Failures > 0 {
+			fmt.Printf(" (%d failed checks in a row: %s)", info.Health.Failures, info.Health.LastError)
+		}
+		fmt.Println()
+	}
 	fmt.Printf("Command: %s\n", info.Command)
 	fmt.Printf("User: %s\n", info.User)
+	if info.Cgroup != "" {
+		fmt.Printf("Cgroup: %s\n", info.Cgroup)
+	}
+	if len(info.Descendants) > 0 {
+		pids := make([]string, len(info.Descendants))
+		for i, pid := range info.Descendants {
+			pids[i] = strconv.Itoa(int(pid))
+		}
+		fmt.Printf("Descendants: %s\n", strings.Join(pids, ", "))
+	}
+
+	// Print the dependency graph
+	if len(info.DependsOn) > 0 {
+		fmt.Println("\nDepends On:")
+		printDependencies(info.DependsOn, "  ")
+	}
+	if len(info.RequiredBy) > 0 {
+		fmt.Printf("\nRequired By: %s\n", strings.Join(info.RequiredBy, ", "))
+	}
 
 	// Print environment variables
-	if len(proc.Config.Environment) > 0 {
+	if len(info.Environment) > 0 {
 		fmt.Println("\nEnvironment Variables:")
 		table := tablewriter.NewWriter(os.Stdout)
 		table.SetHeader([]string{"Key", "Value"})
 		table.SetBorder(false)
 		table.SetColumnSeparator(" ")
 
-		for k, v := range proc.Config.Environment {
+		for k, v := range info.Environment {
 			table.Append([]string{k, v})
 		}
 
@@ -65,7 +106,7 @@ func runInfo(cmd *cobra.Command, args []string) {
 
 	// Print cluster information
 	if info.Instances > 0 {
-		fmt.Printf("\nCluster Mode: %s\n", proc.Config.Cluster.Mode)
+		fmt.Printf("\nCluster Mode: %s\n", info.ClusterMode)
 		fmt.Printf("Instances: %d\n", info.Instances)
 
 		// Print worker processes
@@ -75,12 +116,7 @@ func runInfo(cmd *cobra.Command, args []string) {
 		table.SetBorder(false)
 		table.SetColumnSeparator(" ")
 
-		for _, worker := range proc.ClusterProcs {
-			workerInfo, err := processManager.GetProcessInfo(worker.Config.Name)
-			if err != nil {
-				continue
-			}
-
+		for _, workerInfo := range info.Workers {
 			table.Append([]string{
 				workerInfo.Name,
 				strconv.Itoa(int(workerInfo.PID)),
@@ -95,3 +131,14 @@ func runInfo(cmd *cobra.Command, args []string) {
 	}
 }
 
+// printDependencies prints a dependency graph, each level indented further
+func printDependencies(deps []utils.DependencyInfo, indent string) {
+	for _, dep := range deps {
+		state := "waiting"
+		if dep.Met {
+			state = "met"
+		}
+		fmt.Printf("%s%s (%s, %s): %s\n", indent, dep.Name, dep.Condition, state, dep.Status)
+		printDependencies(dep.DependsOn, indent+"  ")
+	}
+}
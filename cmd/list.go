@@ -21,7 +21,10 @@ var (
 )
 
 func runList(cmd *cobra.Command, args []string) {
-	processes := processManager.ListProcesses()
+	processes, err := client.ListProcesses()
+	if err != nil {
+		logrus.Fatalf("Failed to list processes: %v", err)
+	}
 	if len(processes) == 0 {
 		fmt.Println("No processes running")
 		return
@@ -29,19 +32,25 @@ func runList(cmd *cobra.Command, args []string) {
 
 	// Create table
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "PID", "Status", "CPU", "Memory", "Uptime", "Restarts"})
+	table.SetHeader([]string{"Name", "PID", "Status", "Health", "CPU", "Memory", "Uptime", "Restarts"})
 	table.SetBorder(false)
 	table.SetColumnSeparator(" ")
 
 	// Add rows
 	for _, proc := range processes {
 		// Get process info
-		info, err := processManager.GetProcessInfo(proc.Config.Name)
+		info, err := client.GetProcessInfo(proc.Config.Name)
 		if err != nil {
 			logrus.Warnf("Failed to get process info for %s: %v", proc.Config.Name, err)
 			continue
 		}
 
+		// Processes without a health check have no health
+		health := "-"
+		if info.Health != nil {
+			health = info.Health.Status
+		}
+
 		// Format CPU and memory
 		cpu := fmt.Sprintf("%.1f%%", info.CPU)
 		mem := fmt.Sprintf("%.1f MB", info.Memory)
@@ -51,10 +60,11 @@ func runList(cmd *cobra.Command, args []string) {
 			info.Name,
 			strconv.Itoa(int(info.PID)),
 			info.Status,
+			health,
 			cpu,
 			mem,
 			info.Uptime,
-			strconv.Itoa(proc.Restarts),
+			strconv.Itoa(info.Restarts),
 		})
 	}
 
@@ -41,7 +41,7 @@ func runLogs(cmd *cobra.Command, args []string) {
 	}
 
 	// Get logs
-	logs, err := processManager.GetLogs(name, streamFlag, linesFlag)
+	logs, err := client.GetLogs(name, streamFlag, linesFlag)
 	if err != nil {
 		logrus.Fatalf("Failed to get logs: %v", err)
 	}
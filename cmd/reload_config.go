@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Reload config command
+	reloadConfigCmd = &cobra.Command{
+		Use:   "reload-config",
+		Short: "Reload config.yaml and process definitions",
+		Long: `Make the daemon re-read config.yaml and the .gem file of every process
+started from one, as well as new .gem files in processes_path. Processes whose
+definition changed are restarted, new ones are started. Sending SIGHUP to the
+daemon does the same.`,
+		Args: cobra.NoArgs,
+		Run:  runReloadConfig,
+	}
+)
+
+func runReloadConfig(cmd *cobra.Command, args []string) {
+	result, err := client.ReloadConfig()
+	if err != nil {
+		logrus.Fatalf("Failed to reload configuration: %v", err)
+	}
+
+	printList := func(label string, names []string) {
+		if len(names) > 0 {
+			fmt.Printf("%-17s %s\n", label+":", strings.Join(names, ", "))
+		}
+	}
+	printList("Settings applied", result.Settings)
+	printList("Needs restart", result.RestartRequired)
+	printList("Restarted", result.Restarted)
+	printList("Updated", result.Updated)
+	printList("Started", result.Started)
+	printList("Removed", result.Removed)
+	printList("Unchanged", result.Unchanged)
+
+	names := make([]string, 0, len(result.Failed))
+	for name := range result.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("Failed:           %s: %s\n", name, result.Failed[name])
+	}
+}
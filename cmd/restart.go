@@ -21,7 +21,7 @@ func runRestart(cmd *cobra.Command, args []string) {
 	}
 
 	name := args[0]
-	if err := processManager.RestartProcess(name); err != nil {
+	if err := client.RestartProcess(name); err != nil {
 		logrus.Fatalf("Failed to restart process: %v", err)
 	}
 
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/core"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Resurrect command
+	resurrectCmd = &cobra.Command{
+		Use:   "resurrect [file]",
+		Short: "Restore a saved process list",
+		Long: `Start every process from a dump file written by gem save (default:
+dump_path from config). Processes start after the ones they depend on.
+Processes that are already running, or starting, restarting or stopping,
+are skipped.`,
+		Run: runResurrect,
+	}
+)
+
+func runResurrect(cmd *cobra.Command, args []string) {
+	dumpFile := config.GlobalConfig.DumpPath
+	if len(args) > 0 {
+		dumpFile = args[0]
+	}
+
+	dump, err := config.LoadDump(dumpFile)
+	if err != nil {
+		logrus.Fatalf("Failed to load process list: %v", err)
+	}
+
+	processes, err := client.ListProcesses()
+	if err != nil {
+		logrus.Fatalf("Failed to list processes: %v", err)
+	}
+
+	// A process that isn't done yet would be started a second time
+	active := make(map[string]string)
+	for _, proc := range processes {
+		if !core.IsTerminalStatus(proc.Status) {
+			active[proc.Config.Name] = proc.Status
+		}
+	}
+
+	started, skipped, failed := 0, 0, 0
+	for _, procConfig := range core.SortByDependencies(dump.Processes) {
+		if status, ok := active[procConfig.Name]; ok {
+			logrus.Infof("Process %s is already %s, skipping", procConfig.Name, status)
+			skipped++
+			continue
+		}
+
+		if _, err := client.StartProcess(procConfig); err != nil {
+			logrus.Errorf("Failed to start process %s: %v", procConfig.Name, err)
+			failed++
+			continue
+		}
+
+		logrus.Infof("Started process %s", procConfig.Name)
+		started++
+	}
+
+	logrus.Infof("Resurrected %d processes (%d already active, %d failed)", started, skipped, failed)
+}
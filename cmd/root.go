@@ -5,15 +5,16 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/prism/gem/api"
 	"github.com/prism/gem/config"
-	"github.com/prism/gem/core"
+	"github.com/prism/gem/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var (
-	// Global process manager
-	processManager *core.ProcessManager
+	// Client for the Gem daemon
+	client *api.Client
 
 	// Global flags
 	configDir string
@@ -28,21 +29,38 @@ var rootCmd = &cobra.Command{
 It allows you to manage processes, view tasks, access shells, automate scripts,
 and view logs with ease.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Everything, including the daemon's socket, lives in the config directory
+		dir, err := filepath.Abs(configDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving config directory: %v\n", err)
+			os.Exit(1)
+		}
+		configDir = dir
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating Gem directory: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Initialize logger
+		if err := utils.InitLogger(filepath.Join(configDir, "gem.log")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing logger: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Load configuration
+		if err := config.LoadConfig(configDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
 		// Set log level
+		utils.SetLogLevel(config.GlobalConfig.LogLevel)
 		if verbose {
 			logrus.SetLevel(logrus.DebugLevel)
 		}
 
-		// Initialize process manager
-		processManager = core.NewProcessManager(
-			config.GlobalConfig.ProcessesPath,
-			config.GlobalConfig.LogsPath,
-		)
-
-		// Load running processes
-		if err := processManager.LoadRunningProcesses(); err != nil {
-			logrus.Warnf("Failed to load running processes: %v", err)
-		}
+		// Commands talk to the daemon that owns the processes
+		client = api.NewClient(config.GlobalConfig.SocketPath)
 	},
 }
 
@@ -53,27 +71,40 @@ func Execute() error {
 }
 
 func init() {
-	// Get user home directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting user home directory: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Set default config directory
-	defaultConfigDir := filepath.Join(homeDir, ".gem")
-
 	// Add persistent flags
-	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", defaultConfigDir, "config directory")
+	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", defaultConfigDir(), "config directory (env GEM_HOME)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 
 	// Add commands
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(stopCmd)
 	rootCmd.AddCommand(restartCmd)
+	rootCmd.AddCommand(signalCmd)
+	rootCmd.AddCommand(reloadCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(infoCmd)
 	rootCmd.AddCommand(logsCmd)
 	rootCmd.AddCommand(shellCmd)
 	rootCmd.AddCommand(apiCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(saveCmd)
+	rootCmd.AddCommand(resurrectCmd)
+	rootCmd.AddCommand(eventsCmd)
+	rootCmd.AddCommand(reloadConfigCmd)
+	rootCmd.AddCommand(startupCmd)
+	rootCmd.AddCommand(unstartupCmd)
+}
+
+// defaultConfigDir returns $GEM_HOME, falling back to ~/.gem
+func defaultConfigDir() string {
+	if dir := os.Getenv("GEM_HOME"); dir != "" {
+		return dir
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting user home directory: %v\n", err)
+		os.Exit(1)
+	}
+	return filepath.Join(homeDir, ".gem")
 }
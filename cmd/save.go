@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/prism/gem/config"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Save command
+	saveCmd = &cobra.Command{
+		Use:   "save [file]",
+		Short: "Save the process list",
+		Long: `Save the configuration of every running process, including cluster sizes,
+to a dump file (default: dump_path from config) so it can be restored with
+gem resurrect.`,
+		Run: runSave,
+	}
+)
+
+func runSave(cmd *cobra.Command, args []string) {
+	dumpFile := config.GlobalConfig.DumpPath
+	if len(args) > 0 {
+		dumpFile = args[0]
+	}
+
+	processes, err := client.ListProcesses()
+	if err != nil {
+		logrus.Fatalf("Failed to list processes: %v", err)
+	}
+
+	// Cluster workers are recreated from their master's config
+	workers := make(map[string]bool)
+	for _, proc := range processes {
+		for _, worker := range proc.ClusterProcs {
+			workers[worker.Config.Name] = true
+		}
+	}
+
+	configs := make([]*config.ProcessConfig, 0, len(processes))
+	for _, proc := range processes {
+		if !workers[proc.Config.Name] {
+			configs = append(configs, proc.Config)
+		}
+	}
+
+	if err := config.SaveDump(dumpFile, configs); err != nil {
+		logrus.Fatalf("Failed to save process list: %v", err)
+	}
+
+	logrus.Infof("Saved %d processes to %s", len(configs), dumpFile)
+}
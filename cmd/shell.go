@@ -1,12 +1,13 @@
 package cmd
 
 import (
-	"io"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
-	"github.com/creack/pty"
+	"github.com/gorilla/websocket"
+	"github.com/prism/gem/api"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -30,11 +31,11 @@ func runShell(cmd *cobra.Command, args []string) {
 	name := args[0]
 
 	// Attach shell to process
-	ptmx, err := processManager.AttachShell(name)
+	conn, err := client.AttachShell(name)
 	if err != nil {
 		logrus.Fatalf("Failed to attach shell: %v", err)
 	}
-	defer processManager.DetachShell(name)
+	defer conn.Close()
 
 	// Set up terminal
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
@@ -43,13 +44,25 @@ func runShell(cmd *cobra.Command, args []string) {
 	}
 	defer term.Restore(int(os.Stdin.Fd()), oldState)
 
+	// The websocket takes one writer at a time
+	var writeMutex sync.Mutex
+
 	// Handle window size changes
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGWINCH)
+	defer signal.Stop(ch)
 	go func() {
 		for range ch {
-			if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
-				logrus.Warnf("Failed to resize pty: %v", err)
+			cols, rows, err := term.GetSize(int(os.Stdin.Fd()))
+			if err != nil {
+				logrus.Warnf("Failed to get terminal size: %v", err)
+				continue
+			}
+			writeMutex.Lock()
+			err = api.ResizeShell(conn, uint16(rows), uint16(cols))
+			writeMutex.Unlock()
+			if err != nil {
+				return
 			}
 		}
 	}()
@@ -57,14 +70,26 @@ func runShell(cmd *cobra.Command, args []string) {
 
 	// Set up bidirectional communication
 	go func() {
-		_, err := io.Copy(ptmx, os.Stdin)
-		if err != nil {
-			logrus.Warnf("Error copying stdin to pty: %v", err)
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			writeMutex.Lock()
+			err = conn.WriteMessage(websocket.BinaryMessage, buf[:n])
+			writeMutex.Unlock()
+			if err != nil {
+				return
+			}
 		}
 	}()
 
-	_, err = io.Copy(os.Stdout, ptmx)
-	if err != nil {
-		logrus.Warnf("Error copying pty to stdout: %v", err)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		os.Stdout.Write(data)
 	}
 }
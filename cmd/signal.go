@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Signal command
+	signalCmd = &cobra.Command{
+		Use:   "signal [process-name] [signal]",
+		Short: "Send a signal to a process",
+		Long: `Send a signal, given by name (USR1, SIGUSR1) or number, to a process. For a
+cluster the signal is sent to every worker.`,
+		Args: cobra.ExactArgs(2),
+		Run:  runSignal,
+	}
+
+	// Reload command
+	reloadCmd = &cobra.Command{
+		Use:   "reload [process-name]",
+		Short: "Ask a process to reload its configuration",
+		Long: `Send a process its reload_signal (SIGHUP by default) so it reloads its
+configuration without a restart. For a cluster every worker is reloaded.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runReload,
+	}
+)
+
+func runSignal(cmd *cobra.Command, args []string) {
+	name, signal := args[0], args[1]
+	if err := client.SignalProcess(name, signal); err != nil {
+		logrus.Fatalf("Failed to signal process: %v", err)
+	}
+
+	logrus.Infof("Sent %s to process %s", signal, name)
+}
+
+func runReload(cmd *cobra.Command, args []string) {
+	name := args[0]
+	if err := client.ReloadProcess(name); err != nil {
+		logrus.Fatalf("Failed to reload process: %v", err)
+	}
+
+	logrus.Infof("Process %s reloading", name)
+}
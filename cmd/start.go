@@ -22,30 +22,72 @@ var (
 
 	// Command flags
 	cmdFlag        string
+	typeFlag       string
+	pidFileFlag    string
 	argsFlag       []string
 	cwdFlag        string
 	envFlag        []string
 	restartFlag    string
 	maxRestartsFlag int
+	minUptimeFlag  int
+	killTimeoutFlag int
+	stopSignalFlag string
+	reloadSignalFlag string
+	noProcessGroupFlag bool
 	configFileFlag string
 	clusterFlag    int
 	clusterModeFlag string
 	autoStartFlag  bool
+	dependsOnFlag  []string
+	healthHTTPFlag string
+	healthTCPFlag  string
+	healthExecFlag string
+	healthIntervalFlag int
+	healthRetriesFlag int
+	healthRestartAfterFlag int
+	watchdogSecFlag int
+	maxMemoryRestartFlag string
+	memoryMaxFlag  string
+	memoryHighFlag string
+	cpuMaxFlag     string
+	pidsMaxFlag    int
+	ioWeightFlag   int
 	userFlag       string
 	groupFlag      string
 )
 
 func init() {
 	startCmd.Flags().StringVarP(&cmdFlag, "cmd", "c", "", "command to run")
+	startCmd.Flags().StringVar(&typeFlag, "type", "simple", "process type (simple, forking, notify, oneshot)")
+	startCmd.Flags().StringVar(&pidFileFlag, "pid-file", "", "pid file a forking process writes its main PID to")
 	startCmd.Flags().StringSliceVarP(&argsFlag, "args", "a", nil, "command arguments")
 	startCmd.Flags().StringVarP(&cwdFlag, "cwd", "d", "", "working directory")
 	startCmd.Flags().StringSliceVarP(&envFlag, "env", "e", nil, "environment variables (KEY=VALUE)")
 	startCmd.Flags().StringVarP(&restartFlag, "restart", "r", "on-failure", "restart policy (always, on-failure, no)")
 	startCmd.Flags().IntVarP(&maxRestartsFlag, "max-restarts", "m", 10, "maximum number of restarts")
+	startCmd.Flags().IntVar(&minUptimeFlag, "min-uptime", 0, "seconds a run must last to not count toward max-restarts (default 1)")
+	startCmd.Flags().IntVar(&killTimeoutFlag, "kill-timeout", 0, "seconds to wait after the stop signal before SIGKILL (default shutdown_timeout)")
+	startCmd.Flags().StringVar(&stopSignalFlag, "stop-signal", "", "signal to stop the process with (default SIGTERM)")
+	startCmd.Flags().StringVar(&reloadSignalFlag, "reload-signal", "", "signal gem reload sends to the process (default SIGHUP)")
+	startCmd.Flags().BoolVar(&noProcessGroupFlag, "no-process-group", false, "don't run the process in its own process group")
 	startCmd.Flags().StringVarP(&configFileFlag, "file", "f", "", "configuration file (.gem)")
 	startCmd.Flags().IntVarP(&clusterFlag, "cluster", "n", 0, "number of instances to run in cluster mode")
 	startCmd.Flags().StringVar(&clusterModeFlag, "cluster-mode", "fork", "cluster mode (fork, cluster)")
 	startCmd.Flags().BoolVar(&autoStartFlag, "autostart", false, "automatically start on daemon startup")
+	startCmd.Flags().StringVar(&healthHTTPFlag, "health-http", "", "URL that has to answer 200 for the process to be healthy")
+	startCmd.Flags().StringVar(&healthTCPFlag, "health-tcp", "", "host:port that has to accept connections for the process to be healthy")
+	startCmd.Flags().StringVar(&healthExecFlag, "health-exec", "", "command that has to exit with 0 for the process to be healthy")
+	startCmd.Flags().IntVar(&healthIntervalFlag, "health-interval", 0, "seconds between health checks (default 10)")
+	startCmd.Flags().IntVar(&healthRetriesFlag, "health-retries", 0, "failed health checks in a row before the process is unhealthy (default 3)")
+	startCmd.Flags().IntVar(&healthRestartAfterFlag, "health-restart-after", 0, "failed health checks in a row before the process is restarted (default never)")
+	startCmd.Flags().StringVar(&maxMemoryRestartFlag, "max-memory-restart", "", "memory (e.g. 512M) above which the process is restarted")
+	startCmd.Flags().StringVar(&memoryMaxFlag, "memory-max", "", "hard memory limit of the process's cgroup (e.g. 512M)")
+	startCmd.Flags().StringVar(&memoryHighFlag, "memory-high", "", "memory above which the process's cgroup is throttled (e.g. 400M)")
+	startCmd.Flags().StringVar(&cpuMaxFlag, "cpu-max", "", "CPU limit as quota/period in microseconds or a percentage (e.g. 150%)")
+	startCmd.Flags().IntVar(&pidsMaxFlag, "pids-max", 0, "maximum number of processes and threads in the process's cgroup")
+	startCmd.Flags().IntVar(&ioWeightFlag, "io-weight", 0, "IO weight of the process's cgroup, 1-10000 (default 100)")
+	startCmd.Flags().IntVar(&watchdogSecFlag, "watchdog-sec", 0, "seconds a notify service may go without sending WATCHDOG=1 before it is restarted")
+	startCmd.Flags().StringSliceVar(&dependsOnFlag, "depends-on", nil, "processes to start first (NAME or NAME:CONDITION, condition started, healthy or completed)")
 	startCmd.Flags().StringVar(&userFlag, "user", "", "user to run the process as")
 	startCmd.Flags().StringVar(&groupFlag, "group", "", "group to run the process as")
 }
@@ -75,10 +117,34 @@ func runStart(cmd *cobra.Command, args []string) {
 		procConfig = &config.ProcessConfig{
 			Name:        args[0],
 			Command:     cmdFlag,
+			Type:        typeFlag,
+			PIDFile:     pidFileFlag,
 			Args:        argsFlag,
 			WorkingDir:  cwdFlag,
 			Restart:     restartFlag,
 			MaxRestarts: maxRestartsFlag,
+			MinUptime:   minUptimeFlag,
+			KillTimeout: killTimeoutFlag,
+			StopSignal:  stopSignalFlag,
+			ReloadSignal: reloadSignalFlag,
+			NoProcessGroup: noProcessGroupFlag,
+			WatchdogSec: watchdogSecFlag,
+			MaxMemoryRestart: maxMemoryRestartFlag,
+			Resources: config.ResourcesConfig{
+				MemoryMax:  memoryMaxFlag,
+				MemoryHigh: memoryHighFlag,
+				CPUMax:     cpuMaxFlag,
+				PidsMax:    pidsMaxFlag,
+				IOWeight:   ioWeightFlag,
+			},
+			HealthCheck: config.HealthCheckConfig{
+				HTTP:         healthHTTPFlag,
+				TCP:          healthTCPFlag,
+				Exec:         healthExecFlag,
+				Interval:     healthIntervalFlag,
+				Retries:      healthRetriesFlag,
+				RestartAfter: healthRestartAfterFlag,
+			},
 			AutoStart:   autoStartFlag,
 			User:        userFlag,
 			Group:       groupFlag,
@@ -96,6 +162,15 @@ func runStart(cmd *cobra.Command, args []string) {
 			}
 		}
 
+		// Parse dependencies
+		if len(dependsOnFlag) > 0 {
+			procConfig.DependsOn = make(config.Dependencies)
+			for _, dep := range dependsOnFlag {
+				name, condition, _ := strings.Cut(dep, ":")
+				procConfig.DependsOn[name] = condition
+			}
+		}
+
 		// Set up cluster if requested
 		if clusterFlag > 0 {
 			procConfig.Cluster = config.ClusterConfig{
@@ -119,7 +194,7 @@ func runStart(cmd *cobra.Command, args []string) {
 	}
 
 	// Start the process
-	proc, err := processManager.StartProcess(procConfig)
+	proc, err := client.StartProcess(procConfig)
 	if err != nil {
 		logrus.Fatalf("Failed to start process: %v", err)
 	}
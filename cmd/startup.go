@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/prism/gem/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Startup command flags
+	startupUserFlag      string
+	startupNameFlag      string
+	startupOutputDirFlag string
+	startupInstallFlag   bool
+
+	// Startup command
+	startupCmd = &cobra.Command{
+		Use:   "startup [systemd|openrc|sysv]",
+		Short: "Generate an init script for the daemon",
+		Long: `Generate a service definition that runs the Gem daemon at boot as the given
+user with the current --config-dir. The definition is printed to stdout,
+written to --output-dir, or installed and enabled with --install.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runStartup,
+	}
+
+	// Unstartup command
+	unstartupCmd = &cobra.Command{
+		Use:   "unstartup [systemd|openrc|sysv]",
+		Short: "Remove the daemon's init script",
+		Long: `Disable and remove a service definition installed with gem startup, or
+remove it from --output-dir.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runUnstartup,
+	}
+)
+
+func init() {
+	for _, c := range []*cobra.Command{startupCmd, unstartupCmd} {
+		c.Flags().StringVarP(&startupUserFlag, "user", "u", "", "user to run the daemon as (default: current user)")
+		c.Flags().StringVar(&startupNameFlag, "name", "", "service name (default: gem-<user>)")
+		c.Flags().StringVarP(&startupOutputDirFlag, "output-dir", "o", "", "directory to write the service file to instead of stdout")
+	}
+	startupCmd.Flags().BoolVar(&startupInstallFlag, "install", false, "install into the init system and enable the service")
+}
+
+func runStartup(cmd *cobra.Command, args []string) {
+	system := args[0]
+	opts := startupOptions(cmd)
+
+	script, err := utils.GenerateStartupScript(system, opts)
+	if err != nil {
+		logrus.Fatalf("Failed to generate startup script: %v", err)
+	}
+
+	// Print for review unless asked to write it somewhere
+	if startupOutputDirFlag == "" && !startupInstallFlag {
+		fmt.Print(script)
+		return
+	}
+
+	dir := startupOutputDirFlag
+	if startupInstallFlag {
+		dir = ""
+	}
+	path, err := utils.StartupScriptPath(system, dir, opts.Name)
+	if err != nil {
+		logrus.Fatalf("Failed to generate startup script: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logrus.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(script), utils.StartupScriptMode(system)); err != nil {
+		logrus.Fatalf("Failed to write startup script: %v", err)
+	}
+	logrus.Infof("Wrote %s", path)
+
+	if !startupInstallFlag {
+		return
+	}
+
+	for _, command := range utils.StartupEnableCommands(system, opts.Name) {
+		if err := runInitCommand(command); err != nil {
+			logrus.Fatalf("Failed to enable service %s: %v", opts.Name, err)
+		}
+	}
+	logrus.Infof("Service %s enabled, the Gem daemon will start at boot", opts.Name)
+}
+
+func runUnstartup(cmd *cobra.Command, args []string) {
+	system := args[0]
+	opts := startupOptions(cmd)
+
+	path, err := utils.StartupScriptPath(system, startupOutputDirFlag, opts.Name)
+	if err != nil {
+		logrus.Fatalf("Failed to remove startup script: %v", err)
+	}
+
+	// Only an installed service has to be disabled first
+	before, after := utils.StartupDisableCommands(system, opts.Name)
+	installed := startupOutputDirFlag == ""
+	if installed {
+		for _, command := range before {
+			if err := runInitCommand(command); err != nil {
+				logrus.Warnf("Failed to disable service %s: %v", opts.Name, err)
+			}
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		logrus.Fatalf("Failed to remove startup script: %v", err)
+	}
+	logrus.Infof("Removed %s", path)
+
+	if installed {
+		for _, command := range after {
+			if err := runInitCommand(command); err != nil {
+				logrus.Warnf("Failed to run %s: %v", strings.Join(command, " "), err)
+			}
+		}
+	}
+}
+
+// startupOptions resolves the service options from flags
+func startupOptions(cmd *cobra.Command) utils.StartupOptions {
+	current, err := user.Current()
+	if err != nil {
+		logrus.Fatalf("Failed to get current user: %v", err)
+	}
+
+	username := startupUserFlag
+	if username == "" {
+		username = current.Username
+	}
+
+	// Default to the target user's config dir rather than the caller's
+	dir := configDir
+	if !cmd.Flags().Changed("config-dir") && os.Getenv("GEM_HOME") == "" && username != current.Username {
+		u, err := user.Lookup(username)
+		if err != nil {
+			logrus.Fatalf("Failed to look up user %s: %v", username, err)
+		}
+		dir = filepath.Join(u.HomeDir, ".gem")
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		logrus.Fatalf("Failed to resolve config directory: %v", err)
+	}
+
+	binary, err := os.Executable()
+	if err != nil {
+		logrus.Fatalf("Failed to find the gem binary: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(binary); err == nil {
+		binary = resolved
+	}
+
+	name := startupNameFlag
+	if name == "" {
+		name = "gem-" + username
+	}
+
+	return utils.StartupOptions{
+		Name:      name,
+		User:      username,
+		Binary:    binary,
+		ConfigDir: dir,
+	}
+}
+
+// runInitCommand runs an init system command, showing its output
+func runInitCommand(command []string) error {
+	logrus.Infof("Running %s", strings.Join(command, " "))
+	c := exec.Command(command[0], command[1:]...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
@@ -13,8 +13,10 @@ var (
 	stopCmd = &cobra.Command{
 		Use:   "stop [process-name]",
 		Short: "Stop a process",
-		Long:  `Stop a running process.`,
-		Run:   runStop,
+		Long: `Send the stop signal to the process group of a running process and wait
+for it to exit. A process still running after its kill_timeout is killed with
+SIGKILL.`,
+		Run: runStop,
 	}
 )
 
@@ -28,7 +30,7 @@ func runStop(cmd *cobra.Command, args []string) {
 	}
 
 	name := args[0]
-	if err := processManager.StopProcess(name, forceFlag); err != nil {
+	if err := client.StopProcess(name, forceFlag); err != nil {
 		logrus.Fatalf("Failed to stop process: %v", err)
 	}
 
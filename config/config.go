@@ -4,25 +4,94 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the global configuration for Gem
 type Config struct {
-	LogLevel      string `mapstructure:"log_level"`
-	APIPort       int    `mapstructure:"api_port"`
-	SocketPath    string `mapstructure:"socket_path"`
-	ProcessesPath string `mapstructure:"processes_path"`
-	LogsPath      string `mapstructure:"logs_path"`
-	ClusterMode   bool   `mapstructure:"cluster_mode"`
-	ClusterNodes  []string `mapstructure:"cluster_nodes"`
+	LogLevel             string   `mapstructure:"log_level"`
+	APIPort              int      `mapstructure:"api_port"`
+	SocketPath           string   `mapstructure:"socket_path"`
+	ProcessesPath        string   `mapstructure:"processes_path"`
+	StatePath            string   `mapstructure:"state_path"`
+	DumpPath             string   `mapstructure:"dump_path"`
+	AutoStartParallelism int      `mapstructure:"autostart_parallelism"`
+	ShutdownPolicy       string   `mapstructure:"shutdown_policy"`  // "stop" or "detach"
+	ShutdownTimeout      int      `mapstructure:"shutdown_timeout"` // in seconds
+	LogsPath             string   `mapstructure:"logs_path"`
+	ClusterMode          bool     `mapstructure:"cluster_mode"`
+	ClusterNodes         []string `mapstructure:"cluster_nodes"`
 }
 
-// Global configuration instance
+// Global configuration instance. The daemon reloads it while it runs, from
+// then on it is read through Current.
 var GlobalConfig Config
 
+// configMutex guards GlobalConfig against reloads
+var configMutex sync.RWMutex
+
+// restartRequired are the settings the daemon only reads at boot. A reload
+// keeps their running values.
+var restartRequired = map[string]bool{
+	"socket_path":    true,
+	"state_path":     true,
+	"logs_path":      true,
+	"processes_path": true,
+}
+
+// RequiresRestart reports whether a setting only takes effect once the daemon
+// restarts
+func RequiresRestart(key string) bool {
+	return restartRequired[key]
+}
+
+// Current returns a copy of the global configuration
+func Current() Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return GlobalConfig
+}
+
+// ReloadConfig re-reads config.yaml from the directory it was loaded from and
+// returns the settings that changed. Settings that require a restart are
+// reported but keep their running values.
+func ReloadConfig() ([]string, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var next Config
+	if err := viper.Unmarshal(&next); err != nil {
+		return nil, err
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	// Compare setting by setting
+	var changed []string
+	oldValue, newValue := reflect.ValueOf(GlobalConfig), reflect.ValueOf(&next).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		if reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+		key := oldValue.Type().Field(i).Tag.Get("mapstructure")
+		changed = append(changed, key)
+		if restartRequired[key] {
+			newValue.Field(i).Set(oldValue.Field(i))
+		}
+	}
+
+	GlobalConfig = next
+	return changed, nil
+}
+
 // LoadConfig loads the configuration from the specified directory
 func LoadConfig(configDir string) error {
 	viper.SetConfigName("config")
@@ -34,6 +103,11 @@ func LoadConfig(configDir string) error {
 	viper.SetDefault("api_port", 3456)
 	viper.SetDefault("socket_path", filepath.Join(configDir, "gem.sock"))
 	viper.SetDefault("processes_path", filepath.Join(configDir, "processes"))
+	viper.SetDefault("state_path", filepath.Join(configDir, "state.json"))
+	viper.SetDefault("dump_path", filepath.Join(configDir, "dump.json"))
+	viper.SetDefault("autostart_parallelism", 4)
+	viper.SetDefault("shutdown_policy", "stop")
+	viper.SetDefault("shutdown_timeout", 10)
 	viper.SetDefault("logs_path", filepath.Join(configDir, "logs"))
 	viper.SetDefault("cluster_mode", false)
 	viper.SetDefault("cluster_nodes", []string{})
@@ -79,20 +153,98 @@ func LoadConfig(configDir string) error {
 
 // ProcessConfig represents the configuration for a process
 type ProcessConfig struct {
-	Name         string            `yaml:"name" json:"name"`
-	Command      string            `yaml:"cmd" json:"cmd"`
-	Args         []string          `yaml:"args,omitempty" json:"args,omitempty"`
-	WorkingDir   string            `yaml:"cwd,omitempty" json:"cwd,omitempty"`
-	Environment  map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
-	Restart      string            `yaml:"restart,omitempty" json:"restart,omitempty"` // "always", "on-failure", "no"
-	MaxRestarts  int               `yaml:"max_restarts,omitempty" json:"max_restarts,omitempty"`
-	RestartDelay int               `yaml:"restart_delay,omitempty" json:"restart_delay,omitempty"` // in seconds
-	Cluster      ClusterConfig     `yaml:"cluster,omitempty" json:"cluster,omitempty"`
-	Log          LogConfig         `yaml:"log,omitempty" json:"log,omitempty"`
-	AutoStart    bool              `yaml:"autostart,omitempty" json:"autostart,omitempty"`
-	User         string            `yaml:"user,omitempty" json:"user,omitempty"`
-	Group        string            `yaml:"group,omitempty" json:"group,omitempty"`
-	Scripts      ScriptsConfig     `yaml:"scripts,omitempty" json:"scripts,omitempty"`
+	Name               string            `yaml:"name" json:"name"`
+	Command            string            `yaml:"cmd" json:"cmd"`
+	ConfigFile         string            `yaml:"-" json:"config_file,omitempty"`       // File the definition was loaded from
+	Type               string            `yaml:"type,omitempty" json:"type,omitempty"` // "simple", "forking", "oneshot"
+	PIDFile            string            `yaml:"pid_file,omitempty" json:"pid_file,omitempty"`
+	Args               []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	WorkingDir         string            `yaml:"cwd,omitempty" json:"cwd,omitempty"`
+	Environment        map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Restart            string            `yaml:"restart,omitempty" json:"restart,omitempty"`                             // "always", "on-failure", "no"
+	SuccessExitCodes   []int             `yaml:"success_exit_codes,omitempty" json:"success_exit_codes,omitempty"`       // Exit codes besides 0 that count as a clean exit
+	RestartExitCodes   []int             `yaml:"restart_exit_codes,omitempty" json:"restart_exit_codes,omitempty"`       // Always restarted, whatever the restart policy
+	NoRestartExitCodes []int             `yaml:"no_restart_exit_codes,omitempty" json:"no_restart_exit_codes,omitempty"` // Never restarted
+	SuccessSignals     []string          `yaml:"success_signals,omitempty" json:"success_signals,omitempty"`             // Signals that count as a clean exit
+	MinUptime          int               `yaml:"min_uptime,omitempty" json:"min_uptime,omitempty"`                       // in seconds, exits sooner count toward max_restarts
+	MaxRestarts        int               `yaml:"max_restarts,omitempty" json:"max_restarts,omitempty"`
+	RestartDelay       int               `yaml:"restart_delay,omitempty" json:"restart_delay,omitempty"` // in seconds
+	RestartBackoff     BackoffConfig     `yaml:"restart_backoff,omitempty" json:"restart_backoff,omitempty"`
+	KillTimeout        int               `yaml:"kill_timeout,omitempty" json:"kill_timeout,omitempty"`         // in seconds, defaults to shutdown_timeout
+	StopSignal         string            `yaml:"stop_signal,omitempty" json:"stop_signal,omitempty"`           // defaults to SIGTERM
+	ReloadSignal       string            `yaml:"reload_signal,omitempty" json:"reload_signal,omitempty"`       // defaults to SIGHUP
+	NoProcessGroup     bool              `yaml:"no_process_group,omitempty" json:"no_process_group,omitempty"` // Only signal the process itself, not the group it leads
+	HealthCheck        HealthCheckConfig `yaml:"health_check,omitempty" json:"health_check,omitempty"`
+	WatchdogSec        int               `yaml:"watchdog_sec,omitempty" json:"watchdog_sec,omitempty"`             // in seconds, a notify service has to send WATCHDOG=1 at least this often
+	MaxMemoryRestart   string            `yaml:"max_memory_restart,omitempty" json:"max_memory_restart,omitempty"` // e.g. "512M", the process tree is restarted when its RSS exceeds it
+	Resources          ResourcesConfig   `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Cluster            ClusterConfig     `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+	Log                LogConfig         `yaml:"log,omitempty" json:"log,omitempty"`
+	AutoStart          bool              `yaml:"autostart,omitempty" json:"autostart,omitempty"`
+	DependsOn          Dependencies      `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	User               string            `yaml:"user,omitempty" json:"user,omitempty"`
+	Group              string            `yaml:"group,omitempty" json:"group,omitempty"`
+	Scripts            ScriptsConfig     `yaml:"scripts,omitempty" json:"scripts,omitempty"`
+}
+
+// BackoffConfig represents how the delay between automatic restarts grows
+// while a process keeps crashing
+type BackoffConfig struct {
+	InitialDelay int     `yaml:"initial_delay,omitempty" json:"initial_delay,omitempty"` // in seconds, defaults to restart_delay
+	Multiplier   float64 `yaml:"multiplier,omitempty" json:"multiplier,omitempty"`       // defaults to 1, a fixed delay
+	MaxDelay     int     `yaml:"max_delay,omitempty" json:"max_delay,omitempty"`         // in seconds, defaults to 300
+	Jitter       float64 `yaml:"jitter,omitempty" json:"jitter,omitempty"`               // Fraction of the delay it is randomized by, 0 to 1
+	ResetAfter   int     `yaml:"reset_after,omitempty" json:"reset_after,omitempty"`     // Seconds of uptime after which the delay starts over, defaults to 60
+}
+
+// Dependencies maps the processes a process depends on to the condition each
+// has to meet before it starts: "started", "healthy" or "completed"
+type Dependencies map[string]string
+
+// UnmarshalYAML accepts a plain list of names as well as a map of names to
+// conditions, listed processes only have to be started
+func (d *Dependencies) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		var names []string
+		if err := value.Decode(&names); err != nil {
+			return err
+		}
+		*d = make(Dependencies, len(names))
+		for _, name := range names {
+			(*d)[name] = "started"
+		}
+		return nil
+	}
+
+	var conditions map[string]string
+	if err := value.Decode(&conditions); err != nil {
+		return err
+	}
+	*d = conditions
+	return nil
+}
+
+// HealthCheckConfig represents how Gem checks that a running process works,
+// with exactly one of HTTP, TCP and Exec set
+type HealthCheckConfig struct {
+	HTTP         string `yaml:"http,omitempty" json:"http,omitempty"`                   // URL to GET
+	Status       int    `yaml:"status,omitempty" json:"status,omitempty"`               // Expected HTTP status, defaults to 200
+	TCP          string `yaml:"tcp,omitempty" json:"tcp,omitempty"`                     // host:port to connect to
+	Exec         string `yaml:"exec,omitempty" json:"exec,omitempty"`                   // Shell command that has to exit with 0
+	Interval     int    `yaml:"interval,omitempty" json:"interval,omitempty"`           // in seconds, defaults to 10
+	Timeout      int    `yaml:"timeout,omitempty" json:"timeout,omitempty"`             // in seconds, defaults to 5
+	Retries      int    `yaml:"retries,omitempty" json:"retries,omitempty"`             // Failures in a row before the process is unhealthy, defaults to 3
+	StartPeriod  int    `yaml:"start_period,omitempty" json:"start_period,omitempty"`   // in seconds, failures after a start don't count during it
+	RestartAfter int    `yaml:"restart_after,omitempty" json:"restart_after,omitempty"` // Failures in a row before the process is restarted, 0 never
+}
+
+// ResourcesConfig represents the cgroup v2 resource limits of a process
+type ResourcesConfig struct {
+	MemoryMax  string `yaml:"memory_max,omitempty" json:"memory_max,omitempty"`   // e.g. "512M", the OOM killer steps in above it
+	MemoryHigh string `yaml:"memory_high,omitempty" json:"memory_high,omitempty"` // e.g. "400M", the process is throttled above it
+	CPUMax     string `yaml:"cpu_max,omitempty" json:"cpu_max,omitempty"`         // "quota/period" in microseconds or a percentage of one CPU like "150%"
+	PidsMax    int    `yaml:"pids_max,omitempty" json:"pids_max,omitempty"`       // Maximum number of processes and threads
+	IOWeight   int    `yaml:"io_weight,omitempty" json:"io_weight,omitempty"`     // 1-10000, defaults to 100
 }
 
 // ClusterConfig represents cluster configuration for a process
@@ -120,23 +272,26 @@ type ScriptsConfig struct {
 
 // LoadProcessConfig loads a process configuration from a .gem file
 func LoadProcessConfig(filePath string) (*ProcessConfig, error) {
-	v := viper.New()
-	v.SetConfigFile(filePath)
-	v.SetConfigType("yaml")
-
-	if err := v.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			return nil, fmt.Errorf("unsupported config type: %s", filepath.Ext(filePath))
-		}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
 		return nil, err
 	}
 
+	// Decode with yaml directly, viper would lowercase environment variable names
 	var config ProcessConfig
-	if err := v.Unmarshal(&config); err != nil {
-		return nil, err
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", filePath, err)
+	}
+
+	// Remember where the definition came from so it can be reloaded
+	if absPath, err := filepath.Abs(filePath); err == nil {
+		config.ConfigFile = absPath
 	}
 
 	// Set default values if not provided
+	if config.Type == "" {
+		config.Type = "simple"
+	}
 	if config.Restart == "" {
 		config.Restart = "on-failure"
 	}
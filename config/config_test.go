@@ -23,6 +23,11 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, 3456, GlobalConfig.APIPort)
 	assert.Equal(t, filepath.Join(tempDir, "gem.sock"), GlobalConfig.SocketPath)
 	assert.Equal(t, filepath.Join(tempDir, "processes"), GlobalConfig.ProcessesPath)
+	assert.Equal(t, filepath.Join(tempDir, "state.json"), GlobalConfig.StatePath)
+	assert.Equal(t, filepath.Join(tempDir, "dump.json"), GlobalConfig.DumpPath)
+	assert.Equal(t, 4, GlobalConfig.AutoStartParallelism)
+	assert.Equal(t, "stop", GlobalConfig.ShutdownPolicy)
+	assert.Equal(t, 10, GlobalConfig.ShutdownTimeout)
 	assert.Equal(t, filepath.Join(tempDir, "logs"), GlobalConfig.LogsPath)
 	assert.False(t, GlobalConfig.ClusterMode)
 	assert.Empty(t, GlobalConfig.ClusterNodes)
@@ -135,3 +140,67 @@ cmd: echo
 	assert.Equal(t, 10, procConfig.MaxRestarts)
 	assert.Equal(t, 3, procConfig.RestartDelay)
 }
+
+func TestProcessConfigDependsOn(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-process-depends-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Dependencies with conditions
+	configFile := filepath.Join(tempDir, "api.gem")
+	content := `
+name: api
+cmd: ./api
+depends_on:
+  queue: started
+  migrate: completed
+`
+	err = os.WriteFile(configFile, []byte(content), 0644)
+	assert.NoError(t, err)
+
+	procConfig, err := LoadProcessConfig(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, Dependencies{"queue": "started", "migrate": "completed"}, procConfig.DependsOn)
+
+	// A plain list only needs the processes started
+	content = `
+name: api
+cmd: ./api
+depends_on: [queue, cache-warmer]
+`
+	err = os.WriteFile(configFile, []byte(content), 0644)
+	assert.NoError(t, err)
+
+	procConfig, err = LoadProcessConfig(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, Dependencies{"queue": "started", "cache-warmer": "started"}, procConfig.DependsOn)
+}
+
+func TestSaveLoadDump(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-dump-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	processes := []*ProcessConfig{
+		{Name: "web", Command: "node", Args: []string{"app.js"}, Cluster: ClusterConfig{Instances: 4, Mode: "fork"}},
+		{Name: "worker", Command: "python3", Environment: map[string]string{"QUEUE_URL": "redis://localhost"}},
+	}
+
+	// Save and load the dump
+	dumpFile := filepath.Join(tempDir, "dump.json")
+	err = SaveDump(dumpFile, processes)
+	assert.NoError(t, err)
+
+	dump, err := LoadDump(dumpFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dump.Version)
+	assert.Equal(t, processes, dump.Processes)
+
+	// Dumps from newer versions are refused
+	err = os.WriteFile(dumpFile, []byte(`{"version": 99, "processes": []}`), 0600)
+	assert.NoError(t, err)
+	_, err = LoadDump(dumpFile)
+	assert.Error(t, err)
+}
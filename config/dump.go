@@ -0,0 +1,60 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dumpVersion is the version of the dump file format
+const dumpVersion = 1
+
+// Dump is a snapshot of the managed processes written by `gem save`
+type Dump struct {
+	Version   int              `json:"version"`
+	SavedAt   time.Time        `json:"saved_at"`
+	Processes []*ProcessConfig `json:"processes"`
+}
+
+// SaveDump writes the given process configurations to a dump file
+func SaveDump(filePath string, processes []*ProcessConfig) error {
+	data, err := json.MarshalIndent(&Dump{
+		Version:   dumpVersion,
+		SavedAt:   time.Now(),
+		Processes: processes,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an existing dump is never truncated
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// LoadDump reads a dump file written by SaveDump
+func LoadDump(filePath string) (*Dump, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var dump Dump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("invalid dump file %s: %v", filePath, err)
+	}
+	if dump.Version > dumpVersion {
+		return nil, fmt.Errorf("dump file version %d is newer than supported version %d", dump.Version, dumpVersion)
+	}
+
+	return &dump, nil
+}
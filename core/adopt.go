@@ -0,0 +1,59 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// errExitStatusUnknown is returned when an adopted process exits. It is not
+// our child, so its exit status can't be collected and it counts as a failure.
+var errExitStatusUnknown = errors.New("exit status unknown for adopted process")
+
+// adoptPollInterval is how often adopted processes are checked when pidfds
+// aren't available
+const adoptPollInterval = time.Second
+
+// pollForExit blocks until a process no longer exists
+func pollForExit(pid int) error {
+	for processExists(pid) {
+		time.Sleep(adoptPollInterval)
+	}
+	return errExitStatusUnknown
+}
+
+// reapedExit is the exit of a main process the reaper collected
+type reapedExit struct {
+	status syscall.WaitStatus
+}
+
+func (e *reapedExit) Error() string {
+	if e.status.Signaled() {
+		return fmt.Sprintf("signal: %v", e.status.Signal())
+	}
+	return fmt.Sprintf("exit status %d", e.status.ExitStatus())
+}
+
+// waitMainProcess blocks until the main process of a service exits. One that
+// was reparented to the daemon is reaped by it, so its exit status is known;
+// any other counts as unknown like an adopted process.
+func waitMainProcess(pid int) error {
+	trackMainProcess(pid)
+	defer untrackMainProcess(pid)
+
+	err := waitForExit(pid)
+	if status, ok := collectExit(pid); ok {
+		if status.Exited() && status.ExitStatus() == 0 {
+			return nil
+		}
+		return &reapedExit{status: status}
+	}
+	return err
+}
+
+// processExists checks whether a process with the given PID exists
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
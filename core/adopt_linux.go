@@ -0,0 +1,33 @@
+package core
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitForExit blocks until a process that is not our child exits. It uses a
+// pidfd when the kernel supports it (5.3+) and falls back to polling.
+func waitForExit(pid int) error {
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return errExitStatusUnknown
+		}
+		return pollForExit(pid)
+	}
+	defer unix.Close(pidfd)
+
+	// The pidfd becomes readable once the process has exited
+	fds := []unix.PollFd{{Fd: int32(pidfd), Events: unix.POLLIN}}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == nil {
+			return errExitStatusUnknown
+		}
+		if !errors.Is(err, syscall.EINTR) {
+			return pollForExit(pid)
+		}
+	}
+}
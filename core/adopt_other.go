@@ -0,0 +1,8 @@
+//go:build !linux
+
+package core
+
+// waitForExit blocks until a process that is not our child exits
+func waitForExit(pid int) error {
+	return pollForExit(pid)
+}
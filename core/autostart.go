@@ -0,0 +1,86 @@
+package core
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AutoStartResult summarizes the processes started when the daemon boots
+type AutoStartResult struct {
+	Started []string
+	Failed  map[string]error
+}
+
+// AutoStart starts every stored process marked autostart that isn't already
+// running, starting at most parallelism processes at a time. Processes start
+// after the ones they depend on.
+func (pm *ProcessManager) AutoStart(parallelism int) *AutoStartResult {
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	// Collect the definitions to start, workers come up with their cluster
+	var names []string
+	procStates := pm.store.List()
+	for name, procState := range procStates {
+		if procState.Config == nil || !procState.Config.AutoStart || procState.Cluster != "" {
+			continue
+		}
+		if _, err := pm.GetProcess(name); err == nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Each level only starts once the one before it is up
+	levels, failed := dependencyLevels(names, pm.definition)
+	result := &AutoStartResult{Failed: failed}
+	var resultMutex sync.Mutex
+	slots := make(chan struct{}, parallelism)
+
+	for _, level := range levels {
+		var wg sync.WaitGroup
+		for _, name := range level {
+			wg.Add(1)
+			slots <- struct{}{}
+
+			go func(name string) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				_, err := pm.StartProcess(procStates[name].Config)
+
+				resultMutex.Lock()
+				defer resultMutex.Unlock()
+				if err != nil {
+					result.Failed[name] = err
+					return
+				}
+				result.Started = append(result.Started, name)
+			}(name)
+		}
+		wg.Wait()
+	}
+
+	sort.Strings(result.Started)
+	return result
+}
+
+// LogSummary logs which processes came up and which failed
+func (result *AutoStartResult) LogSummary() {
+	if len(result.Started) == 0 && len(result.Failed) == 0 {
+		logrus.Info("Autostart: no processes to start")
+		return
+	}
+
+	logrus.Infof("Autostart: %d started, %d failed", len(result.Started), len(result.Failed))
+	for _, name := range result.Started {
+		logrus.Infof("Autostart: started %s", name)
+	}
+	for name, err := range result.Failed {
+		logrus.Errorf("Autostart: failed to start %s: %v", name, err)
+	}
+}
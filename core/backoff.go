@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// defaultMaxBackoff caps the restart delay unless restart_backoff sets max_delay
+const defaultMaxBackoff = 5 * time.Minute
+
+// defaultBackoffReset is the uptime after which the restart delay starts over
+// unless restart_backoff sets reset_after
+const defaultBackoffReset = time.Minute
+
+// validateBackoff checks the restart backoff settings of a process
+func validateBackoff(procConfig *config.ProcessConfig) error {
+	backoff := procConfig.RestartBackoff
+	if backoff.InitialDelay < 0 || backoff.MaxDelay < 0 || backoff.ResetAfter < 0 {
+		return fmt.Errorf("process %s: restart_backoff delays can't be negative", procConfig.Name)
+	}
+	if backoff.Multiplier < 0 {
+		return fmt.Errorf("process %s: restart_backoff multiplier can't be negative", procConfig.Name)
+	}
+	if backoff.Jitter < 0 || backoff.Jitter > 1 {
+		return fmt.Errorf("process %s: restart_backoff jitter must be between 0 and 1", procConfig.Name)
+	}
+	return nil
+}
+
+// backoffReset returns how long a process has to stay up for its restart
+// delay to start over
+func backoffReset(procConfig *config.ProcessConfig) time.Duration {
+	if procConfig.RestartBackoff.ResetAfter > 0 {
+		return time.Duration(procConfig.RestartBackoff.ResetAfter) * time.Second
+	}
+	return defaultBackoffReset
+}
+
+// nextBackoff returns the backoff for the restart of a process that exited
+// after running for uptime. The delay grows with every restart and starts
+// over once the process stayed up long enough.
+func nextBackoff(procConfig *config.ProcessConfig, previous *utils.BackoffState, uptime time.Duration) *utils.BackoffState {
+	backoff := procConfig.RestartBackoff
+
+	attempt := 1
+	if previous != nil && uptime < backoffReset(procConfig) {
+		attempt = previous.Attempt + 1
+	}
+
+	initial := time.Duration(procConfig.RestartDelay) * time.Second
+	if backoff.InitialDelay > 0 {
+		initial = time.Duration(backoff.InitialDelay) * time.Second
+	}
+	multiplier := backoff.Multiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	maxDelay := defaultMaxBackoff
+	if backoff.MaxDelay > 0 {
+		maxDelay = time.Duration(backoff.MaxDelay) * time.Second
+	}
+
+	// Grow the delay, without overflowing on long crash loops
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(maxDelay) {
+		delay = float64(maxDelay)
+	}
+
+	// Spread restarts of processes that crashed together
+	if backoff.Jitter > 0 {
+		delay += delay * backoff.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return &utils.BackoffState{
+		Attempt: attempt,
+		Delay:   time.Duration(delay).Round(time.Millisecond),
+	}
+}
+
+// backoffState returns the restart backoff of a process, or nil once it has
+// stayed up long enough for the delay to start over
+func (pm *ProcessManager) backoffState(proc *ManagedProcess) *utils.BackoffState {
+	procState, exists := pm.store.Get(proc.Config.Name)
+	if !exists || procState.Backoff == nil {
+		return nil
+	}
+
+	proc.mu.RLock()
+	status, startTime := proc.Status, proc.StartTime
+	proc.mu.RUnlock()
+	if status == "running" && time.Since(startTime) >= backoffReset(proc.Config) {
+		return nil
+	}
+	return procState.Backoff
+}
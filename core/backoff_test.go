@@ -0,0 +1,57 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextBackoff(t *testing.T) {
+	procConfig := &config.ProcessConfig{
+		Name:         "test-process",
+		RestartDelay: 3,
+		RestartBackoff: config.BackoffConfig{
+			InitialDelay: 1,
+			Multiplier:   2,
+			MaxDelay:     5,
+			ResetAfter:   30,
+		},
+	}
+
+	// The delay doubles with every crash up to the max
+	var backoff *utils.BackoffState
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		backoff = nextBackoff(procConfig, backoff, time.Second)
+		delays = append(delays, backoff.Delay)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, delays)
+	assert.Equal(t, 5, backoff.Attempt)
+
+	// It starts over once the process stayed up long enough
+	backoff = nextBackoff(procConfig, backoff, time.Minute)
+	assert.Equal(t, 1, backoff.Attempt)
+	assert.Equal(t, time.Second, backoff.Delay)
+
+	// Jitter stays within its fraction of the delay
+	procConfig.RestartBackoff.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		backoff = nextBackoff(procConfig, nil, 0)
+		assert.GreaterOrEqual(t, backoff.Delay, 500*time.Millisecond)
+		assert.LessOrEqual(t, backoff.Delay, 1500*time.Millisecond)
+	}
+
+	// Without restart_backoff the delay is a fixed restart_delay
+	plain := &config.ProcessConfig{Name: "plain", RestartDelay: 3}
+	backoff = nextBackoff(plain, &utils.BackoffState{Attempt: 7}, time.Second)
+	assert.Equal(t, 8, backoff.Attempt)
+	assert.Equal(t, 3*time.Second, backoff.Delay)
+
+	// Invalid settings are rejected
+	assert.Error(t, validateBackoff(&config.ProcessConfig{RestartBackoff: config.BackoffConfig{Jitter: 2}}))
+	assert.Error(t, validateBackoff(&config.ProcessConfig{RestartBackoff: config.BackoffConfig{Multiplier: -1}}))
+	assert.NoError(t, validateBackoff(procConfig))
+}
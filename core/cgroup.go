@@ -0,0 +1,360 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// cgroupMount is where the cgroup v2 hierarchy is mounted
+const cgroupMount = "/sys/fs/cgroup"
+
+// Layout of Gem's cgroup subtree. A cgroup can only hand controllers down to
+// its children while no process runs in it, so the daemon moves into a leaf
+// of its own and every process gets a cgroup under processes.
+const (
+	cgroupDaemonLeaf = "daemon"
+	cgroupProcesses  = "processes"
+)
+
+// cgroupControllers are enabled for the cgroups of the processes if available
+var cgroupControllers = []string{"cpu", "io", "memory", "pids"}
+
+// defaultCPUPeriod is the cpu.max period, in microseconds, of a percentage
+const defaultCPUPeriod = 100000
+
+// oomKillReason is recorded for processes the kernel's OOM killer killed
+const oomKillReason = "oom killed"
+
+// cgroupLimit is a value written to a cgroup interface file. Limits that
+// aren't set are reset to the kernel default.
+type cgroupLimit struct {
+	file  string
+	value string
+	set   bool
+}
+
+// hasResources reports whether any resource limit is configured
+func hasResources(procConfig *config.ProcessConfig) bool {
+	return procConfig.Resources != config.ResourcesConfig{}
+}
+
+// validateResources checks the resources setting of a process
+func validateResources(procConfig *config.ProcessConfig) error {
+	if _, err := cgroupLimits(procConfig.Resources); err != nil {
+		return fmt.Errorf("invalid resources for process %s: %v", procConfig.Name, err)
+	}
+	return nil
+}
+
+// cgroupLimits returns what is written to the cgroup of a process
+func cgroupLimits(resources config.ResourcesConfig) ([]cgroupLimit, error) {
+	memoryMax, err := cgroupBytes(resources.MemoryMax)
+	if err != nil {
+		return nil, fmt.Errorf("memory_max: %v", err)
+	}
+	memoryHigh, err := cgroupBytes(resources.MemoryHigh)
+	if err != nil {
+		return nil, fmt.Errorf("memory_high: %v", err)
+	}
+	cpuMax, err := parseCPUMax(resources.CPUMax)
+	if err != nil {
+		return nil, fmt.Errorf("cpu_max: %v", err)
+	}
+
+	pidsMax := "max"
+	if resources.PidsMax < 0 {
+		return nil, fmt.Errorf("pids_max must not be negative")
+	} else if resources.PidsMax > 0 {
+		pidsMax = strconv.Itoa(resources.PidsMax)
+	}
+
+	ioWeight := "default 100"
+	if resources.IOWeight < 0 || resources.IOWeight > 10000 {
+		return nil, fmt.Errorf("io_weight must be between 1 and 10000")
+	} else if resources.IOWeight > 0 {
+		ioWeight = fmt.Sprintf("default %d", resources.IOWeight)
+	}
+
+	return []cgroupLimit{
+		{file: "memory.max", value: memoryMax, set: resources.MemoryMax != ""},
+		{file: "memory.high", value: memoryHigh, set: resources.MemoryHigh != ""},
+		{file: "cpu.max", value: cpuMax, set: resources.CPUMax != ""},
+		{file: "pids.max", value: pidsMax, set: resources.PidsMax > 0},
+		{file: "io.weight", value: ioWeight, set: resources.IOWeight > 0},
+	}, nil
+}
+
+// cgroupBytes turns a size like "512M" into a memory limit, no size is no limit
+func cgroupBytes(size string) (string, error) {
+	if size == "" || size == "max" {
+		return "max", nil
+	}
+
+	bytes, err := utils.ParseSize(size)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(bytes, 10), nil
+}
+
+// parseCPUMax turns "quota/period" in microseconds, or a percentage of one
+// CPU, into a cpu.max value
+func parseCPUMax(cpuMax string) (string, error) {
+	if cpuMax == "" || cpuMax == "max" {
+		return "max", nil
+	}
+
+	quota, period := 0, defaultCPUPeriod
+	if percent, ok := strings.CutSuffix(cpuMax, "%"); ok {
+		value, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || value <= 0 {
+			return "", fmt.Errorf("invalid percentage %q", cpuMax)
+		}
+		quota = int(value / 100 * defaultCPUPeriod)
+	} else {
+		// The kernel's own "quota period" is accepted as well
+		fields := strings.FieldsFunc(cpuMax, func(r rune) bool { return r == '/' || r == ' ' })
+		if len(fields) != 2 {
+			return "", fmt.Errorf("%q is neither quota/period nor a percentage", cpuMax)
+		}
+		var err error
+		if quota, err = strconv.Atoi(fields[0]); err != nil {
+			return "", fmt.Errorf("invalid quota %q", fields[0])
+		}
+		if period, err = strconv.Atoi(fields[1]); err != nil || period < 1000 || period > 1000000 {
+			return "", fmt.Errorf("period %q must be between 1000 and 1000000", fields[1])
+		}
+	}
+
+	if quota < 1000 {
+		return "", fmt.Errorf("%q is less than the minimum quota of 1000us", cpuMax)
+	}
+	return fmt.Sprintf("%d %d", quota, period), nil
+}
+
+// EnableCgroups sets up Gem's cgroup subtree under the daemon's own cgroup, so
+// every process started afterwards runs in a cgroup of its own with its
+// resource limits. Without a writable cgroup v2 hierarchy processes run
+// without one.
+func (pm *ProcessManager) EnableCgroups() {
+	root, err := setupCgroups()
+	if err != nil {
+		logrus.Warnf("cgroup v2 is not writable, processes run without cgroups and their resource limits are not applied: %v", err)
+		return
+	}
+
+	// Older kernels can't start a process right in its cgroup
+	cgroupFD := cgroupFDSupported(filepath.Join(root, cgroupDaemonLeaf))
+	if !cgroupFD {
+		logrus.Warn("The kernel can't start processes in their cgroup (needs Linux 5.7), they are moved there once started and what they fork before may escape it")
+	}
+
+	pm.mutex.Lock()
+	pm.cgroupRoot = root
+	pm.cgroupFD = cgroupFD
+	pm.mutex.Unlock()
+	logrus.Infof("Running processes in cgroups under %s", root)
+}
+
+// setupCgroups creates Gem's cgroup subtree and returns its root
+func setupCgroups() (string, error) {
+	own, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+
+	// A daemon restarted in the same cgroup has moved into its leaf before
+	root := filepath.Join(cgroupMount, own)
+	if filepath.Base(root) == cgroupDaemonLeaf {
+		root = filepath.Dir(root)
+	}
+
+	// The daemon leaves the root of the subtree to the processes
+	leaf := filepath.Join(root, cgroupDaemonLeaf)
+	if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	if err := writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		return "", err
+	}
+
+	processes := filepath.Join(root, cgroupProcesses)
+	if err := os.Mkdir(processes, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	for _, dir := range []string{root, processes} {
+		if err := enableControllers(dir); err != nil {
+			return "", err
+		}
+	}
+	return root, nil
+}
+
+// enableControllers hands the available controllers of a cgroup down to its
+// children
+func enableControllers(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+
+	available := make(map[string]bool)
+	for _, controller := range strings.Fields(string(data)) {
+		available[controller] = true
+	}
+
+	var enable []string
+	for _, controller := range cgroupControllers {
+		if available[controller] {
+			enable = append(enable, "+"+controller)
+		}
+	}
+	if len(enable) == 0 {
+		return nil
+	}
+	return writeCgroupFile(dir, "cgroup.subtree_control", strings.Join(enable, " "))
+}
+
+// writeCgroupFile writes a value to an interface file of a cgroup
+func writeCgroupFile(dir, file, value string) error {
+	f, err := os.OpenFile(filepath.Join(dir, file), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(value); err != nil {
+		return fmt.Errorf("failed to write %q to %s: %v", value, file, err)
+	}
+	return nil
+}
+
+// applyCgroupLimits writes resource limits to a cgroup. Resetting a limit
+// whose controller isn't enabled is skipped, setting one fails.
+func applyCgroupLimits(dir string, limits []cgroupLimit) error {
+	for _, limit := range limits {
+		err := writeCgroupFile(dir, limit.file, limit.value)
+		if err != nil && (limit.set || !os.IsNotExist(err)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readOOMKills returns how often the OOM killer killed a process in a cgroup
+func readOOMKills(dir string) uint64 {
+	if dir == "" {
+		return 0
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, ok := strings.Cut(line, " "); ok && key == "oom_kill" {
+			count, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			return count
+		}
+	}
+	return 0
+}
+
+// cgroupPath returns the cgroup of a process, the caller must hold pm.mutex
+func (pm *ProcessManager) cgroupPath(name string) string {
+	return filepath.Join(pm.cgroupRoot, cgroupProcesses, name)
+}
+
+// setupCgroup creates a fresh cgroup with the resource limits of a process
+// and makes cmd start in it. It returns the cgroup and the file cmd refers to
+// it by, which the caller closes once cmd has started. Without a file the
+// kernel can't start cmd in the cgroup and the caller moves it there with
+// moveToCgroup. A process whose cgroup can't be set up runs without one.
+func (pm *ProcessManager) setupCgroup(cmd *exec.Cmd, procConfig *config.ProcessConfig) (string, *os.File) {
+	name := procConfig.Name
+	pm.mutex.RLock()
+	enabled, cgroupFD, dir := pm.cgroupRoot != "", pm.cgroupFD, pm.cgroupPath(name)
+	pm.mutex.RUnlock()
+	if !enabled {
+		if hasResources(procConfig) {
+			logrus.Warnf("Resource limits of process %s are not applied, cgroup v2 is not available", name)
+		}
+		return "", nil
+	}
+
+	// The cgroup of an earlier instance is replaced, unless something it
+	// started still runs in it
+	os.Remove(dir)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		logrus.Warnf("Failed to create cgroup for process %s, it runs without one: %v", name, err)
+		return "", nil
+	}
+
+	limits, err := cgroupLimits(procConfig.Resources)
+	if err == nil {
+		err = applyCgroupLimits(dir, limits)
+	}
+	if err != nil {
+		logrus.Warnf("Failed to apply resource limits of process %s: %v", name, err)
+	}
+
+	if !cgroupFD {
+		return dir, nil
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		logrus.Warnf("Failed to open cgroup of process %s, it runs without one: %v", name, err)
+		return "", nil
+	}
+	useCgroup(cmd, f)
+	return dir, f
+}
+
+// moveToCgroup moves a process that started outside its cgroup into it and
+// returns the cgroup, or nothing if the process runs without one
+func moveToCgroup(name, dir string, pid int) string {
+	if err := writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+		logrus.Warnf("Failed to move process %s into its cgroup, it runs without one: %v", name, err)
+		removeCgroup(dir)
+		return ""
+	}
+	return dir
+}
+
+// inCgroup reports whether pid runs in the cgroup dir
+func inCgroup(dir string, pid int) bool {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Fields(string(data)) {
+		if line == strconv.Itoa(pid) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeCgroup removes the cgroup of a process that is gone, which only works
+// once nothing runs in it anymore
+func removeCgroup(dir string) {
+	if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		logrus.Debugf("Failed to remove cgroup %s: %v", dir, err)
+	}
+}
+
+// oomKilled reports whether the OOM killer killed a process in the cgroup of
+// a process since it started
+func (proc *ManagedProcess) oomKilled() bool {
+	return proc.cgroup != "" && readOOMKills(proc.cgroup) > proc.oomKills
+}
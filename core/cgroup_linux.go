@@ -0,0 +1,62 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ownCgroup returns the cgroup v2 path of the daemon, relative to the mount
+func ownCgroup() (string, error) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(cgroupMount, &fs); err != nil {
+		return "", err
+	}
+	if fs.Type != unix.CGROUP2_SUPER_MAGIC {
+		return "", fmt.Errorf("%s is not a cgroup v2 mount", cgroupMount)
+	}
+
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	// The unified hierarchy is the one with ID 0 and no controllers
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", errors.New("the daemon is not in a cgroup v2")
+}
+
+// useCgroup makes cmd start right in the cgroup dir refers to, so nothing it
+// forks escapes it
+func useCgroup(cmd *exec.Cmd, dir *os.File) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+}
+
+// cgroupFDSupported reports whether the kernel can start a process right in a
+// cgroup, which clone3 only can from Linux 5.7. It starts a short-lived shell
+// in the cgroup dir to find out.
+func cgroupFDSupported(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	cmd := exec.Command("sh", "-c", "exit 0")
+	useCgroup(cmd, f)
+	err = runCommand(cmd)
+	return !errors.Is(err, syscall.ENOSYS) && !errors.Is(err, syscall.EINVAL)
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package core
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// ownCgroup is only supported on Linux
+func ownCgroup() (string, error) {
+	return "", errors.New("cgroups are only supported on Linux")
+}
+
+// useCgroup has nothing to do without cgroups
+func useCgroup(cmd *exec.Cmd, dir *os.File) {}
+
+// cgroupFDSupported is only supported on Linux
+func cgroupFDSupported(dir string) bool {
+	return false
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prism/gem/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	// cpu_max takes quota/period or a percentage of one CPU
+	for cpuMax, expected := range map[string]string{
+		"":             "max",
+		"150%":         "150000 100000",
+		"50000/100000": "50000 100000",
+		"20000 50000":  "20000 50000",
+	} {
+		value, err := parseCPUMax(cpuMax)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value, cpuMax)
+	}
+	for _, cpuMax := range []string{"0%", "fast", "500/100000", "10000/10", "1/2/3"} {
+		_, err := parseCPUMax(cpuMax)
+		assert.Error(t, err, cpuMax)
+	}
+
+	// Limits that aren't set are reset
+	limits, err := cgroupLimits(config.ResourcesConfig{MemoryMax: "512M", PidsMax: 64, IOWeight: 500})
+	assert.NoError(t, err)
+	assert.Equal(t, []cgroupLimit{
+		{file: "memory.max", value: "536870912", set: true},
+		{file: "memory.high", value: "max"},
+		{file: "cpu.max", value: "max"},
+		{file: "pids.max", value: "64", set: true},
+		{file: "io.weight", value: "default 500", set: true},
+	}, limits)
+
+	assert.ErrorContains(t, validateResources(&config.ProcessConfig{Name: "web", Resources: config.ResourcesConfig{MemoryHigh: "lots"}}), "memory_high")
+	assert.Error(t, validateResources(&config.ProcessConfig{Name: "web", Resources: config.ResourcesConfig{PidsMax: -1}}))
+	assert.Error(t, validateResources(&config.ProcessConfig{Name: "web", Resources: config.ResourcesConfig{IOWeight: 20000}}))
+}
+
+func TestCgroupFiles(t *testing.T) {
+	// A directory stands in for the cgroup
+	dir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"memory.max", "memory.high", "pids.max"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, file), nil, 0644))
+	}
+
+	// Interface files of controllers that aren't enabled only matter when set
+	limits, err := cgroupLimits(config.ResourcesConfig{MemoryMax: "1G", PidsMax: 10})
+	assert.NoError(t, err)
+	assert.NoError(t, applyCgroupLimits(dir, limits))
+	data, _ := os.ReadFile(filepath.Join(dir, "memory.max"))
+	assert.Equal(t, "1073741824", string(data))
+	data, _ = os.ReadFile(filepath.Join(dir, "pids.max"))
+	assert.Equal(t, "10", string(data))
+	assert.NoFileExists(t, filepath.Join(dir, "cpu.max"))
+
+	limits, err = cgroupLimits(config.ResourcesConfig{CPUMax: "50%"})
+	assert.NoError(t, err)
+	assert.Error(t, applyCgroupLimits(dir, limits))
+
+	// OOM kills are counted in memory.events
+	assert.Equal(t, uint64(0), readOOMKills(dir))
+	events := "low 0\nhigh 4\nmax 2\noom 1\noom_kill 1\noom_group_kill 0\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "memory.events"), []byte(events), 0644))
+	assert.Equal(t, uint64(1), readOOMKills(dir))
+	assert.True(t, (&ManagedProcess{cgroup: dir}).oomKilled())
+	assert.False(t, (&ManagedProcess{cgroup: dir, oomKills: 1}).oomKilled())
+	assert.False(t, (&ManagedProcess{}).oomKilled())
+
+	// A process that started outside its cgroup is moved into it
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), nil, 0644))
+	assert.Equal(t, dir, moveToCgroup("web", dir, 42))
+	data, _ = os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	assert.Equal(t, "42", string(data))
+	assert.Equal(t, "", moveToCgroup("web", filepath.Join(dir, "missing"), 42))
+}
+
+func TestResourcesWithoutCgroups(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager, cgroups are never enabled
+	pm := NewProcessManager(store, logsPath)
+
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "bad", Command: "sleep", Args: []string{"30"}, Resources: config.ResourcesConfig{CPUMax: "fast"}})
+	assert.Error(t, err)
+
+	// The process runs without its limits
+	proc, err := pm.StartProcess(&config.ProcessConfig{
+		Name:      "limited",
+		Command:   "sleep",
+		Args:      []string{"30"},
+		Resources: config.ResourcesConfig{MemoryMax: "64M", CPUMax: "50%"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "running", proc.Status)
+	assert.Empty(t, proc.cgroup)
+
+	info, err := pm.GetProcessInfo("limited")
+	assert.NoError(t, err)
+	assert.Empty(t, info.Cgroup)
+
+	assert.NoError(t, pm.StopProcess("limited", false))
+}
@@ -0,0 +1,434 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// dependencyTimeout is how long a start waits for a dependency to meet its condition
+const dependencyTimeout = 5 * time.Minute
+
+// Conditions a dependency has to meet before the process depending on it starts
+const (
+	conditionStarted   = "started"
+	conditionHealthy   = "healthy"
+	conditionCompleted = "completed"
+)
+
+// validateDependencies checks the depends_on setting of a process
+func validateDependencies(procConfig *config.ProcessConfig) error {
+	for name, condition := range procConfig.DependsOn {
+		if name == procConfig.Name {
+			return fmt.Errorf("process %s cannot depend on itself", name)
+		}
+		switch dependencyCondition(condition) {
+		case conditionStarted, conditionHealthy, conditionCompleted:
+		default:
+			return fmt.Errorf("invalid condition %q for dependency %s, must be started, healthy or completed", condition, name)
+		}
+	}
+	return nil
+}
+
+// dependencyCondition returns a condition, a dependency without one only has
+// to be started
+func dependencyCondition(condition string) string {
+	if condition == "" {
+		return conditionStarted
+	}
+	return condition
+}
+
+// dependencyNames returns the names of the dependencies of a process in order
+func dependencyNames(procConfig *config.ProcessConfig) []string {
+	names := make([]string, 0, len(procConfig.DependsOn))
+	for name := range procConfig.DependsOn {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findCycle returns the first dependency cycle reachable from a process, or
+// nil when there is none. lookup returns the definition of a process, nil for
+// unknown ones.
+func findCycle(name string, lookup func(name string) *config.ProcessConfig) []string {
+	var path []string
+	onPath := make(map[string]bool)
+	checked := make(map[string]bool)
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		if onPath[name] {
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+		if checked[name] {
+			return nil
+		}
+		procConfig := lookup(name)
+		if procConfig == nil {
+			checked[name] = true
+			return nil
+		}
+
+		onPath[name] = true
+		path = append(path, name)
+		for _, dep := range dependencyNames(procConfig) {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		onPath[name] = false
+		checked[name] = true
+		return nil
+	}
+
+	return visit(name)
+}
+
+// cycleError describes a dependency cycle
+func cycleError(cycle []string) error {
+	return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+}
+
+// dependencyLevels groups processes so that every process comes after the
+// ones it depends on. Processes in the same level don't depend on each other
+// and can start in parallel. Dependencies outside of names don't affect the
+// order. Processes in or depending on a cycle are returned as failed.
+func dependencyLevels(names []string, lookup func(name string) *config.ProcessConfig) ([][]string, map[string]error) {
+	failed := make(map[string]error)
+	included := make(map[string]bool, len(names))
+	for _, name := range names {
+		if cycle := findCycle(name, lookup); cycle != nil {
+			failed[name] = cycleError(cycle)
+			continue
+		}
+		included[name] = true
+	}
+
+	// Without cycles the level of every process is well defined
+	level := make(map[string]int)
+	var levelOf func(name string) int
+	levelOf = func(name string) int {
+		if l, ok := level[name]; ok {
+			return l
+		}
+		l := 0
+		for _, dep := range dependencyNames(lookup(name)) {
+			if included[dep] && levelOf(dep)+1 > l {
+				l = levelOf(dep) + 1
+			}
+		}
+		level[name] = l
+		return l
+	}
+
+	var levels [][]string
+	for _, name := range names {
+		if !included[name] {
+			continue
+		}
+		l := levelOf(name)
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], name)
+	}
+	return levels, failed
+}
+
+// SortByDependencies orders process definitions so that every process comes
+// after the ones it depends on, keeping the given order otherwise
+func SortByDependencies(procConfigs []*config.ProcessConfig) []*config.ProcessConfig {
+	byName := make(map[string]*config.ProcessConfig, len(procConfigs))
+	names := make([]string, len(procConfigs))
+	for i, procConfig := range procConfigs {
+		byName[procConfig.Name] = procConfig
+		names[i] = procConfig.Name
+	}
+
+	levels, failed := dependencyLevels(names, func(name string) *config.ProcessConfig { return byName[name] })
+	sorted := make([]*config.ProcessConfig, 0, len(procConfigs))
+	for _, level := range levels {
+		for _, name := range level {
+			sorted = append(sorted, byName[name])
+		}
+	}
+
+	// Processes in a cycle go last, starting them reports the cycle
+	for _, name := range names {
+		if _, ok := failed[name]; ok {
+			sorted = append(sorted, byName[name])
+		}
+	}
+	return sorted
+}
+
+// definition returns the definition of a process, nil if there is none
+func (pm *ProcessManager) definition(name string) *config.ProcessConfig {
+	pm.mutex.RLock()
+	proc, exists := pm.processes[name]
+	pm.mutex.RUnlock()
+	if exists {
+		return proc.Config
+	}
+
+	if procState, ok := pm.store.Get(name); ok && procState.Cluster == "" {
+		return procState.Config
+	}
+	return nil
+}
+
+// startDependencies starts the dependencies of a process that aren't running
+// yet and waits until each of them meets its condition
+func (pm *ProcessManager) startDependencies(procConfig *config.ProcessConfig) error {
+	if len(procConfig.DependsOn) == 0 {
+		return nil
+	}
+	if err := validateDependencies(procConfig); err != nil {
+		return err
+	}
+
+	// The definition being started replaces the stored one
+	lookup := func(name string) *config.ProcessConfig {
+		if name == procConfig.Name {
+			return procConfig
+		}
+		return pm.definition(name)
+	}
+	if cycle := findCycle(procConfig.Name, lookup); cycle != nil {
+		return cycleError(cycle)
+	}
+
+	for _, name := range dependencyNames(procConfig) {
+		condition := dependencyCondition(procConfig.DependsOn[name])
+		depConfig := pm.definition(name)
+		if depConfig == nil {
+			return fmt.Errorf("process %s depends on unknown process %s", procConfig.Name, name)
+		}
+
+		if err := pm.ensureDependency(depConfig, condition, procConfig.Name); err != nil {
+			return err
+		}
+		if err := pm.waitDependency(name, condition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureDependency starts a dependency unless it is running already or, when
+// it only has to complete, has completed before
+func (pm *ProcessManager) ensureDependency(depConfig *config.ProcessConfig, condition, dependent string) error {
+	name := depConfig.Name
+
+	pm.mutex.RLock()
+	_, running := pm.processes[name]
+	pm.mutex.RUnlock()
+	if running {
+		return nil
+	}
+	if procState, ok := pm.store.Get(name); ok && condition == conditionCompleted && procState.Status == "completed" {
+		return nil
+	}
+
+	// Its own dependencies come first
+	if err := pm.startDependencies(depConfig); err != nil {
+		return fmt.Errorf("failed to start dependency %s: %v", name, err)
+	}
+
+	logrus.Infof("Starting process %s, a dependency of %s", name, dependent)
+	pm.mutex.Lock()
+
+	// Someone else may have started it in the meantime
+	if _, exists := pm.processes[name]; exists || pm.starting[name] {
+		pm.mutex.Unlock()
+		return nil
+	}
+	err := pm.reserveStart(depConfig)
+	pm.mutex.Unlock()
+	if err == nil {
+		_, err = pm.spawnProcess(depConfig)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start dependency %s: %v", name, err)
+	}
+	return nil
+}
+
+// waitDependency waits until a dependency meets its condition
+func (pm *ProcessManager) waitDependency(name, condition string) error {
+	sub := pm.events.Subscribe(0)
+	defer sub.Close()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timeout := time.After(dependencyTimeout)
+
+	for {
+		met, err := pm.dependencyMet(name, condition)
+		if err != nil || met {
+			return err
+		}
+
+		select {
+		case <-sub.Events():
+		case <-ticker.C:
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for dependency %s to be %s", name, condition)
+		}
+	}
+}
+
+// dependencyMet reports whether a dependency meets its condition. It fails
+// when the dependency can no longer meet it.
+func (pm *ProcessManager) dependencyMet(name, condition string) (bool, error) {
+	pm.mutex.RLock()
+	proc, exists := pm.processes[name]
+	closing, starting := pm.closing, pm.starting[name]
+	pm.mutex.RUnlock()
+	if closing {
+		return false, fmt.Errorf("the daemon is shutting down")
+	}
+	if starting {
+		return false, nil
+	}
+
+	if exists {
+		proc.mu.RLock()
+		status := proc.Status
+		proc.mu.RUnlock()
+
+		switch status {
+		case "running":
+			// Processes without a health check are healthy once running
+			if condition == conditionHealthy {
+				health := proc.healthState()
+				return health == nil || health.Status == healthHealthy, nil
+			}
+			return condition != conditionCompleted, nil
+		case "errored":
+			return false, fmt.Errorf("dependency %s is errored", name)
+		}
+		return false, nil
+	}
+
+	procState, ok := pm.store.Get(name)
+	if !ok {
+		return false, fmt.Errorf("dependency %s is unknown", name)
+	}
+	switch procState.Status {
+	case "completed":
+		return true, nil
+	case "stopped", "failed", "errored":
+		return false, fmt.Errorf("dependency %s is %s", name, procState.Status)
+	}
+	return false, nil
+}
+
+// processStatus returns the status of a process, running or not
+func (pm *ProcessManager) processStatus(name string) string {
+	pm.mutex.RLock()
+	proc, exists := pm.processes[name]
+	pm.mutex.RUnlock()
+	if exists {
+		proc.mu.RLock()
+		defer proc.mu.RUnlock()
+		return proc.Status
+	}
+
+	if procState, ok := pm.store.Get(name); ok {
+		return procState.Status
+	}
+	return "unknown"
+}
+
+// dependencyGraph describes the dependencies of a process, and theirs in turn
+func (pm *ProcessManager) dependencyGraph(procConfig *config.ProcessConfig, path []string) []utils.DependencyInfo {
+	path = append(path, procConfig.Name)
+
+	var graph []utils.DependencyInfo
+	for _, name := range dependencyNames(procConfig) {
+		condition := dependencyCondition(procConfig.DependsOn[name])
+		met, _ := pm.dependencyMet(name, condition)
+		dep := utils.DependencyInfo{
+			Name:      name,
+			Condition: condition,
+			Status:    pm.processStatus(name),
+			Met:       met,
+		}
+
+		// A cycle is only followed once
+		inPath := false
+		for _, n := range path {
+			inPath = inPath || n == name
+		}
+		if depConfig := pm.definition(name); depConfig != nil && !inPath {
+			dep.DependsOn = pm.dependencyGraph(depConfig, path)
+		}
+		graph = append(graph, dep)
+	}
+	return graph
+}
+
+// dependents returns the processes that depend on a process
+func (pm *ProcessManager) dependents(name string) []string {
+	var dependents []string
+	for other, procState := range pm.store.List() {
+		if procState.Config == nil || procState.Cluster != "" {
+			continue
+		}
+		if _, ok := procState.Config.DependsOn[name]; ok {
+			dependents = append(dependents, other)
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// dependentsFirst orders processes so that every process comes before the
+// ones it depends on, keeping the given order otherwise
+func dependentsFirst(processes []*ManagedProcess) []*ManagedProcess {
+	ordered := make([]*ManagedProcess, 0, len(processes))
+	placed := make(map[string]bool, len(processes))
+
+	remaining := processes
+	for len(remaining) > 0 {
+		var next []*ManagedProcess
+		for _, proc := range remaining {
+			// Wait for the processes still to place that depend on it
+			waiting := false
+			for _, other := range remaining {
+				if _, ok := other.Config.DependsOn[proc.Config.Name]; ok && other != proc && !placed[other.Config.Name] {
+					waiting = true
+					break
+				}
+			}
+			if waiting {
+				next = append(next, proc)
+				continue
+			}
+			ordered = append(ordered, proc)
+			placed[proc.Config.Name] = true
+		}
+
+		// Processes in a cycle keep their order
+		if len(next) == len(remaining) {
+			return append(ordered, next...)
+		}
+		remaining = next
+	}
+	return ordered
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prism/gem/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencyOrder(t *testing.T) {
+	definitions := map[string]*config.ProcessConfig{
+		"api":     {Name: "api", DependsOn: config.Dependencies{"queue": "started", "migrate": "completed"}},
+		"queue":   {Name: "queue"},
+		"migrate": {Name: "migrate", DependsOn: config.Dependencies{"db": ""}},
+		"worker":  {Name: "worker", DependsOn: config.Dependencies{"queue": ""}},
+		"a":       {Name: "a", DependsOn: config.Dependencies{"b": ""}},
+		"b":       {Name: "b", DependsOn: config.Dependencies{"a": ""}},
+		"c":       {Name: "c", DependsOn: config.Dependencies{"a": ""}},
+	}
+	lookup := func(name string) *config.ProcessConfig { return definitions[name] }
+
+	// Cycles are found, unknown processes end the search
+	assert.Nil(t, findCycle("api", lookup))
+	assert.Equal(t, []string{"a", "b", "a"}, findCycle("a", lookup))
+	assert.Equal(t, []string{"a", "b", "a"}, findCycle("c", lookup))
+
+	// Every process comes after its dependencies, db isn't part of the set
+	levels, failed := dependencyLevels([]string{"api", "migrate", "queue", "worker", "a", "c"}, lookup)
+	assert.Equal(t, [][]string{{"migrate", "queue"}, {"api", "worker"}}, levels)
+	assert.Len(t, failed, 2)
+	assert.EqualError(t, failed["c"], "dependency cycle: a -> b -> a")
+
+	sorted := SortByDependencies([]*config.ProcessConfig{definitions["api"], definitions["a"], definitions["queue"], definitions["migrate"], definitions["b"]})
+	var names []string
+	for _, procConfig := range sorted {
+		names = append(names, procConfig.Name)
+	}
+	assert.Equal(t, []string{"queue", "migrate", "api", "a", "b"}, names)
+
+	// Dependents are stopped first
+	processes := []*ManagedProcess{{Config: definitions["queue"]}, {Config: definitions["api"]}, {Config: definitions["worker"]}}
+	names = nil
+	for _, proc := range dependentsFirst(processes) {
+		names = append(names, proc.Config.Name)
+	}
+	assert.Equal(t, []string{"api", "worker", "queue"}, names)
+
+	// Conditions are validated
+	assert.NoError(t, validateDependencies(definitions["api"]))
+	assert.Error(t, validateDependencies(&config.ProcessConfig{Name: "x", DependsOn: config.Dependencies{"y": "ready"}}))
+	assert.Error(t, validateDependencies(&config.ProcessConfig{Name: "x", DependsOn: config.Dependencies{"x": ""}}))
+}
+
+func TestStartDependencies(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+
+	// The dependencies are only known to the store
+	migrated := filepath.Join(tempDir, "migrated")
+	for _, procConfig := range []*config.ProcessConfig{
+		{Name: "queue", Command: "sleep", Args: []string{"30"}},
+		{Name: "migrate", Command: "sh", Args: []string{"-c", "sleep 0.5; touch " + migrated}, Type: "oneshot"},
+	} {
+		procConfig := procConfig
+		assert.NoError(t, store.UpdateProcess(procConfig.Name, func(procState *ProcessState) {
+			procState.Config = procConfig
+		}))
+	}
+
+	// Starting the api starts the queue and waits for the migration
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:      "api",
+		Command:   "sleep",
+		Args:      []string{"30"},
+		DependsOn: config.Dependencies{"queue": "started", "migrate": "completed"},
+	})
+	assert.NoError(t, err)
+	assert.FileExists(t, migrated)
+
+	procState, _ := store.Get("migrate")
+	assert.Equal(t, "completed", procState.Status)
+	queue, err := pm.GetProcess("queue")
+	assert.NoError(t, err)
+	assert.Equal(t, "running", queue.Status)
+
+	// The graph shows both directions
+	info, err := pm.GetProcessInfo("api")
+	assert.NoError(t, err)
+	assert.Len(t, info.DependsOn, 2)
+	assert.Equal(t, "migrate", info.DependsOn[0].Name)
+	assert.Equal(t, "completed", info.DependsOn[0].Status)
+	assert.True(t, info.DependsOn[0].Met)
+	info, err = pm.GetProcessInfo("queue")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api"}, info.RequiredBy)
+
+	// Any process that exits successfully completes, and isn't run again
+	seeded := filepath.Join(tempDir, "seeded")
+	assert.NoError(t, store.UpdateProcess("seed", func(procState *ProcessState) {
+		procState.Config = &config.ProcessConfig{Name: "seed", Command: "sh", Args: []string{"-c", "echo run >> " + seeded}}
+	}))
+	worker := &config.ProcessConfig{Name: "worker", Command: "sleep", Args: []string{"30"}, DependsOn: config.Dependencies{"seed": "completed"}}
+	for i := 0; i < 2; i++ {
+		_, err = pm.StartProcess(worker)
+		assert.NoError(t, err)
+		assert.NoError(t, pm.StopProcess("worker", false))
+	}
+	procState, _ = store.Get("seed")
+	assert.Equal(t, "completed", procState.Status)
+	data, err := os.ReadFile(seeded)
+	assert.NoError(t, err)
+	assert.Equal(t, "run\n", string(data))
+
+	// Cycles and unknown dependencies are refused
+	assert.NoError(t, store.UpdateProcess("b", func(procState *ProcessState) {
+		procState.Config = &config.ProcessConfig{Name: "b", Command: "sleep", Args: []string{"30"}, DependsOn: config.Dependencies{"a": ""}}
+	}))
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "a", Command: "sleep", Args: []string{"30"}, DependsOn: config.Dependencies{"b": ""}})
+	assert.EqualError(t, err, "dependency cycle: a -> b -> a")
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "c", Command: "sleep", Args: []string{"30"}, DependsOn: config.Dependencies{"missing": ""}})
+	assert.Error(t, err)
+	_, err = pm.GetProcess("b")
+	assert.Error(t, err)
+
+	// The api is stopped before the queue it depends on
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+	done := make(chan struct{})
+	go func() {
+		pm.StopAll()
+		close(done)
+	}()
+
+	var stopped []string
+	timeout := time.After(30 * time.Second)
+	for len(stopped) < 2 {
+		select {
+		case event := <-sub.Events():
+			if event.Type == EventStopped {
+				stopped = append(stopped, event.Process)
+			}
+		case <-timeout:
+			t.Fatal("processes were not stopped")
+		}
+	}
+	<-done
+	assert.Equal(t, []string{"api", "queue"}, stopped)
+}
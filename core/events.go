@@ -0,0 +1,118 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies a lifecycle change of a process
+type EventType string
+
+const (
+	EventStarting      EventType = "starting"       // About to run pre-start and spawn the process
+	EventStarted       EventType = "started"        // The process is running, PID is set
+	EventExited        EventType = "exited"         // The process exited, ExitCode and Signal are set
+	EventBackoff       EventType = "backoff"        // Waiting Delay before a restart
+	EventRestarting    EventType = "restarting"     // The process is being started again
+	EventGaveUp        EventType = "gave-up"        // The process won't be restarted anymore
+	EventHookFailed    EventType = "hook-failed"    // A lifecycle script failed, Hook and Error are set
+	EventStopped       EventType = "stopped"        // The process was stopped on request
+	EventHealthChanged EventType = "health-changed" // Health is the new health state
+)
+
+// defaultEventBuffer is the number of events a subscriber can fall behind by
+const defaultEventBuffer = 64
+
+// Event describes one lifecycle change of a process
+type Event struct {
+	Type     EventType     `json:"type"`
+	Process  string        `json:"process"`
+	Time     time.Time     `json:"time"`
+	PID      int           `json:"pid,omitempty"`
+	ExitCode int           `json:"exit_code,omitempty"` // -1 when killed by a signal or unknown
+	Signal   string        `json:"signal,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+	Delay    time.Duration `json:"delay,omitempty"`
+	Hook     string        `json:"hook,omitempty"` // "pre_start", "post_start", "pre_stop" or "post_stop"
+	Health   string        `json:"health,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// EventBus delivers events to subscribers without ever blocking the publisher
+type EventBus struct {
+	subscribers map[*Subscription]struct{}
+	mutex       sync.RWMutex
+}
+
+// Subscription receives events from an EventBus
+type Subscription struct {
+	events  chan Event
+	dropped uint64
+	bus     *EventBus
+}
+
+// NewEventBus creates a new event bus
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber that can fall behind by up to buffer
+// events. Events published while its buffer is full are dropped for it.
+func (b *EventBus) Subscribe(buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = defaultEventBuffer
+	}
+
+	sub := &Subscription{
+		events: make(chan Event, buffer),
+		bus:    b,
+	}
+
+	b.mutex.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mutex.Unlock()
+
+	return sub
+}
+
+// Publish delivers an event to every subscriber with room for it
+func (b *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events lost because the buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close unsubscribes and closes the events channel
+func (s *Subscription) Close() {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+
+	if _, exists := s.bus.subscribers[s]; exists {
+		delete(s.bus.subscribers, s)
+		close(s.events)
+	}
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe(2)
+
+	// Events are delivered in order with a timestamp
+	bus.Publish(Event{Type: EventStarting, Process: "a"})
+	event := <-sub.Events()
+	assert.Equal(t, EventStarting, event.Type)
+	assert.Equal(t, "a", event.Process)
+	assert.False(t, event.Time.IsZero())
+
+	// A full buffer drops events instead of blocking the publisher
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			bus.Publish(Event{Type: EventStarted, Process: "a"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+	assert.Equal(t, uint64(3), sub.Dropped())
+
+	// Closing unsubscribes and closes the channel once drained
+	sub.Close()
+	bus.Publish(Event{Type: EventStopped, Process: "a"})
+	count := 0
+	for range sub.Events() {
+		count++
+	}
+	assert.Equal(t, 2, count)
+	sub.Close()
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// forkingStartTimeout is how long a forking service has to produce its main
+// process once the command it was started with has exited
+const forkingStartTimeout = 10 * time.Second
+
+// validateProcessType checks the type of a process and the options it needs
+func validateProcessType(procConfig *config.ProcessConfig) error {
+	switch procConfig.Type {
+	case "", "simple", "notify", "oneshot":
+		return nil
+	case "forking":
+		if procConfig.Cluster.Instances > 1 {
+			return fmt.Errorf("process %s: forking services can't run in cluster mode", procConfig.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("process %s: invalid type %q, must be simple, forking, notify or oneshot", procConfig.Name, procConfig.Type)
+	}
+}
+
+// pidFilePath returns the absolute path of a process's pid file, relative
+// paths are resolved against its working directory
+func pidFilePath(procConfig *config.ProcessConfig) string {
+	if procConfig.PIDFile == "" || filepath.IsAbs(procConfig.PIDFile) || procConfig.WorkingDir == "" {
+		return procConfig.PIDFile
+	}
+	return filepath.Join(procConfig.WorkingDir, procConfig.PIDFile)
+}
+
+// waitForking waits for the command a forking service was started with to
+// exit and switches the process over to the main process it left behind
+func (pm *ProcessManager) waitForking(proc *ManagedProcess) error {
+	name := proc.Config.Name
+
+	if err := waitCommand(proc.Cmd); err != nil {
+		return err
+	}
+
+	pid, err := findMainPID(proc)
+	if err != nil {
+		logrus.Errorf("Forking service %s: %v", name, err)
+		return err
+	}
+
+	fingerprint, err := utils.GetProcessFingerprint(int32(pid))
+	if err != nil {
+		logrus.Errorf("Forking service %s: main process %d is gone: %v", name, pid, err)
+		return err
+	}
+
+	// From here on the main process is tracked like an adopted one
+	proc.mu.Lock()
+	proc.Cmd = nil
+	proc.PID = pid
+	proc.fingerprint = fingerprint
+	proc.Status = "running"
+	stopping := proc.stopping
+	proc.mu.Unlock()
+
+	err = pm.store.UpdateProcess(name, func(procState *ProcessState) {
+		procState.Status = "running"
+		procState.PID = pid
+		procState.Fingerprint = fingerprint
+	})
+	if err != nil {
+		logrus.Warnf("Failed to save state for process %s: %v", name, err)
+	}
+
+	pm.events.Publish(Event{Type: EventStarted, Process: name, PID: pid})
+	logrus.Infof("Forking service %s is running with main PID %d", name, pid)
+
+	// A stop that came in while the service was starting applies now
+	if stopping {
+		sig, err := stopSignal(proc.Config)
+		if err != nil {
+			sig = syscall.SIGTERM
+		}
+		proc.signalGroup(sig)
+	}
+	return nil
+}
+
+// findMainPID returns the main process of a forking service, read from its
+// pid file or, without one, the only descendant it left behind
+func findMainPID(proc *ManagedProcess) (int, error) {
+	procConfig := proc.Config
+	pidFile := pidFilePath(procConfig)
+	deadline := time.Now().Add(forkingStartTimeout)
+
+	for {
+		if pidFile != "" {
+			// Init never qualifies, even where it can't be seen
+			pid, err := readPIDFile(pidFile)
+			if err == nil && (pid == 1 || processExists(pid)) {
+				if err := proc.validateMainPID(pid); err != nil {
+					return 0, fmt.Errorf("pid file %s: %v", pidFile, err)
+				}
+				return pid, nil
+			}
+		} else {
+			descendants := findDescendants(0, procConfig.Name)
+			if len(descendants) == 1 {
+				return int(descendants[0]), nil
+			}
+			if len(descendants) > 1 {
+				return 0, fmt.Errorf("left %d processes behind, set pid_file to tell which one is the main process", len(descendants))
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if pidFile != "" {
+				return 0, fmt.Errorf("no running process in pid file %s after %s", pidFile, forkingStartTimeout)
+			}
+			return 0, fmt.Errorf("no process left running after %s", forkingStartTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// validateMainPID checks that pid may become the main process of a service.
+// Its process group is signalled on stop, so it is never init or the daemon,
+// and it has to be part of the service: in its cgroup or carrying its marker.
+// Where the environment of other processes can't be read, a descendant of
+// the daemon is accepted instead of the marker.
+func (proc *ManagedProcess) validateMainPID(pid int) error {
+	if pid <= 1 || pid == os.Getpid() {
+		return fmt.Errorf("main PID %d is init or the daemon", pid)
+	}
+
+	proc.mu.RLock()
+	cgroup := proc.cgroup
+	proc.mu.RUnlock()
+	if cgroup != "" && inCgroup(cgroup, pid) {
+		return nil
+	}
+
+	environ, err := processEnviron(int32(pid))
+	if err != nil {
+		if descendsFrom(int32(pid), int32(os.Getpid())) {
+			return nil
+		}
+	} else if containsEnv(environ, processEnvMarker+"="+proc.Config.Name) {
+		return nil
+	}
+	return fmt.Errorf("main PID %d is not part of process %s", pid, proc.Config.Name)
+}
+
+// readPIDFile reads the PID a service wrote to its pid file
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid file %s", path)
+	}
+	return pid, nil
+}
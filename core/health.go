@@ -0,0 +1,259 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// Health check defaults
+const (
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	defaultHealthRetries  = 3
+	defaultHealthStatus   = http.StatusOK
+)
+
+// Health states of a process with a health check
+const (
+	healthStarting  = "starting"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+)
+
+// hasHealthCheck reports whether a health check is configured
+func hasHealthCheck(procConfig *config.ProcessConfig) bool {
+	check := procConfig.HealthCheck
+	return check.HTTP != "" || check.TCP != "" || check.Exec != ""
+}
+
+// validateHealthCheck checks the health_check setting of a process
+func validateHealthCheck(procConfig *config.ProcessConfig) error {
+	check := procConfig.HealthCheck
+	if !hasHealthCheck(procConfig) {
+		return nil
+	}
+
+	kinds := 0
+	for _, target := range []string{check.HTTP, check.TCP, check.Exec} {
+		if target != "" {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return fmt.Errorf("health_check of process %s must set only one of http, tcp and exec", procConfig.Name)
+	}
+
+	if check.HTTP != "" {
+		u, err := url.Parse(check.HTTP)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid health_check url %q for process %s", check.HTTP, procConfig.Name)
+		}
+	}
+	if check.TCP != "" {
+		if _, _, err := net.SplitHostPort(check.TCP); err != nil {
+			return fmt.Errorf("invalid health_check address %q for process %s: %v", check.TCP, procConfig.Name, err)
+		}
+	}
+	if check.Interval < 0 || check.Timeout < 0 || check.Retries < 0 || check.StartPeriod < 0 || check.RestartAfter < 0 {
+		return fmt.Errorf("health_check settings of process %s must not be negative", procConfig.Name)
+	}
+	return nil
+}
+
+// healthInterval returns the time between two health checks
+func healthInterval(check config.HealthCheckConfig) time.Duration {
+	if check.Interval > 0 {
+		return time.Duration(check.Interval) * time.Second
+	}
+	return defaultHealthInterval
+}
+
+// healthTimeout returns how long a single health check may take
+func healthTimeout(check config.HealthCheckConfig) time.Duration {
+	if check.Timeout > 0 {
+		return time.Duration(check.Timeout) * time.Second
+	}
+	return defaultHealthTimeout
+}
+
+// healthRetries returns the failures in a row after which a process is unhealthy
+func healthRetries(check config.HealthCheckConfig) int {
+	if check.Retries > 0 {
+		return check.Retries
+	}
+	return defaultHealthRetries
+}
+
+// checkHealth runs a health check once
+func checkHealth(procConfig *config.ProcessConfig) error {
+	check := procConfig.HealthCheck
+	timeout := healthTimeout(check)
+
+	switch {
+	case check.HTTP != "":
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(check.HTTP)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		expected := check.Status
+		if expected == 0 {
+			expected = defaultHealthStatus
+		}
+		if resp.StatusCode != expected {
+			return fmt.Errorf("GET %s returned %d, expected %d", check.HTTP, resp.StatusCode, expected)
+		}
+		return nil
+
+	case check.TCP != "":
+		conn, err := net.DialTimeout("tcp", check.TCP, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		// The command runs where and as the process runs
+		cmd := exec.CommandContext(ctx, "sh", "-c", check.Exec)
+		cmd.Dir = procConfig.WorkingDir
+		cmd.Env = processEnvironment(procConfig)
+		if procConfig.User != "" {
+			if err := setProcessUser(cmd, procConfig.User, procConfig.Group); err != nil {
+				return err
+			}
+		}
+
+		// A timeout kills whatever the command started along with it
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Setpgid = true
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		cmd.WaitDelay = time.Second
+
+		output := &strings.Builder{}
+		cmd.Stdout = output
+		cmd.Stderr = output
+		err := runCommand(cmd)
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		if err != nil {
+			if out := strings.TrimSpace(output.String()); out != "" {
+				return fmt.Errorf("%v: %s", err, out)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// monitorHealth checks the health of a process until it exits, marking it
+// unhealthy after retries failed checks in a row and restarting it after
+// restart_after of them
+func (pm *ProcessManager) monitorHealth(proc *ManagedProcess) {
+	check := proc.Config.HealthCheck
+	name := proc.Config.Name
+	retries := healthRetries(check)
+	startPeriod := time.Duration(check.StartPeriod) * time.Second
+
+	ticker := time.NewTicker(healthInterval(check))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-proc.done:
+			return
+		case <-ticker.C:
+		}
+
+		// Only a running process is checked
+		proc.mu.RLock()
+		status, startTime, previous := proc.Status, proc.StartTime, proc.Health
+		proc.mu.RUnlock()
+		if status != "running" {
+			continue
+		}
+
+		err := checkHealth(proc.Config)
+		health := &utils.HealthState{Status: previous.Status, LastCheck: time.Now()}
+		if err == nil {
+			health.Status = healthHealthy
+		} else {
+			health.LastError = err.Error()
+
+			// Failures while the process is still starting up don't count
+			if previous.Status != healthStarting || time.Since(startTime) >= startPeriod {
+				health.Failures = previous.Failures + 1
+			}
+			if health.Failures >= retries {
+				health.Status = healthUnhealthy
+			}
+		}
+
+		proc.mu.Lock()
+		proc.Health = health
+		proc.mu.Unlock()
+
+		if health.Status != previous.Status {
+			if err != nil {
+				logrus.Warnf("Process %s is %s: %v", name, health.Status, err)
+			} else {
+				logrus.Infof("Process %s is %s", name, health.Status)
+			}
+			pm.events.Publish(Event{Type: EventHealthChanged, Process: name, Health: health.Status, Error: health.LastError})
+		}
+
+		if check.RestartAfter > 0 && health.Failures >= check.RestartAfter {
+			logrus.Warnf("Process %s failed %d health checks in a row, restarting it", name, health.Failures)
+			pm.restartWithReason(proc, "health check failed", func(procState *ProcessState) {
+				procState.Restarts++
+			})
+			return
+		}
+	}
+}
+
+// startHealthCheck starts checking the health of a process if it has a check
+func (pm *ProcessManager) startHealthCheck(proc *ManagedProcess) {
+	if !hasHealthCheck(proc.Config) {
+		return
+	}
+
+	proc.mu.Lock()
+	proc.Health = &utils.HealthState{Status: healthStarting}
+	proc.mu.Unlock()
+
+	go pm.monitorHealth(proc)
+}
+
+// healthState returns a copy of the health of a process, nil without a check
+func (proc *ManagedProcess) healthState() *utils.HealthState {
+	proc.mu.RLock()
+	defer proc.mu.RUnlock()
+
+	if proc.Health == nil {
+		return nil
+	}
+	health := *proc.Health
+	return &health
+}
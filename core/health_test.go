@@ -0,0 +1,137 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prism/gem/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckHealth(t *testing.T) {
+	// Exactly one kind of check is allowed
+	assert.NoError(t, validateHealthCheck(&config.ProcessConfig{Name: "web", HealthCheck: config.HealthCheckConfig{HTTP: "http://localhost:8080/health"}}))
+	assert.Error(t, validateHealthCheck(&config.ProcessConfig{Name: "web", HealthCheck: config.HealthCheckConfig{HTTP: "localhost:8080"}}))
+	assert.Error(t, validateHealthCheck(&config.ProcessConfig{Name: "web", HealthCheck: config.HealthCheckConfig{TCP: "8080"}}))
+	assert.Error(t, validateHealthCheck(&config.ProcessConfig{Name: "web", HealthCheck: config.HealthCheckConfig{TCP: "localhost:8080", Exec: "true"}}))
+
+	// Exec checks pass on exit code 0
+	assert.NoError(t, checkHealth(&config.ProcessConfig{HealthCheck: config.HealthCheckConfig{Exec: "true"}}))
+	assert.ErrorContains(t, checkHealth(&config.ProcessConfig{HealthCheck: config.HealthCheckConfig{Exec: "echo broken; exit 1"}}), "broken")
+	assert.ErrorContains(t, checkHealth(&config.ProcessConfig{HealthCheck: config.HealthCheckConfig{Exec: "sleep 5", Timeout: 1}}), "timed out")
+
+	// They get the environment and the user of the process
+	check := config.HealthCheckConfig{Exec: `test "$MODE" = ready`}
+	assert.NoError(t, checkHealth(&config.ProcessConfig{Environment: map[string]string{"MODE": "ready"}, HealthCheck: check}))
+	assert.Error(t, checkHealth(&config.ProcessConfig{HealthCheck: check}))
+	if os.Geteuid() == 0 {
+		nobody, err := lookupCredential("nobody", "")
+		assert.NoError(t, err)
+		check = config.HealthCheckConfig{Exec: fmt.Sprintf(`test "$(id -u)" = %d`, nobody.Uid)}
+		assert.NoError(t, checkHealth(&config.ProcessConfig{User: "nobody", HealthCheck: check}))
+	}
+
+	// TCP checks pass while something listens
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	assert.NoError(t, checkHealth(&config.ProcessConfig{HealthCheck: config.HealthCheckConfig{TCP: address}}))
+	listener.Close()
+	assert.Error(t, checkHealth(&config.ProcessConfig{HealthCheck: config.HealthCheckConfig{TCP: address}}))
+
+	// HTTP checks compare the status
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	assert.Error(t, checkHealth(&config.ProcessConfig{HealthCheck: config.HealthCheckConfig{HTTP: server.URL}}))
+	assert.NoError(t, checkHealth(&config.ProcessConfig{HealthCheck: config.HealthCheckConfig{HTTP: server.URL, Status: http.StatusNoContent}}))
+}
+
+func TestHealthCheckRestart(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+
+	// The endpoint stays healthy until it is switched off
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	proc, err := pm.StartProcess(&config.ProcessConfig{
+		Name:    "web",
+		Command: "sleep",
+		Args:    []string{"30"},
+		HealthCheck: config.HealthCheckConfig{
+			HTTP:         server.URL,
+			Interval:     1,
+			Retries:      1,
+			RestartAfter: 2,
+		},
+	})
+	assert.NoError(t, err)
+	pid := proc.PID
+
+	info, err := pm.GetProcessInfo("web")
+	assert.NoError(t, err)
+	assert.Equal(t, "starting", info.Health.Status)
+
+	waitFor := func(match func(event Event) bool) Event {
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case event := <-sub.Events():
+				if match(event) {
+					return event
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for event")
+			}
+		}
+	}
+
+	event := waitFor(func(event Event) bool { return event.Type == EventHealthChanged })
+	assert.Equal(t, "healthy", event.Health)
+	info, err = pm.GetProcessInfo("web")
+	assert.NoError(t, err)
+	assert.Equal(t, "healthy", info.Health.Status)
+
+	// Failing checks make it unhealthy and then restart it
+	failing.Store(true)
+	event = waitFor(func(event Event) bool { return event.Type == EventHealthChanged })
+	assert.Equal(t, "unhealthy", event.Health)
+	assert.Contains(t, event.Error, "503")
+
+	event = waitFor(func(event Event) bool { return event.Type == EventRestarting })
+	assert.Equal(t, "health check failed", event.Reason)
+	waitFor(func(event Event) bool { return event.Type == EventStarted })
+
+	proc, err = pm.GetProcess("web")
+	assert.NoError(t, err)
+	assert.NotEqual(t, pid, proc.PID)
+	assert.Equal(t, 1, proc.Restarts)
+	assert.Equal(t, "starting", proc.healthState().Status)
+
+	assert.NoError(t, pm.StopProcess("web", false))
+}
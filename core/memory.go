@@ -0,0 +1,89 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// memoryCheckInterval is how often processes with a memory limit are sampled
+const memoryCheckInterval = 5 * time.Second
+
+// memoryLimitReason is recorded for processes restarted for their memory use
+const memoryLimitReason = "memory limit"
+
+// maxMemory returns the max_memory_restart limit of a process in bytes, 0
+// when it has none
+func maxMemory(procConfig *config.ProcessConfig) (uint64, error) {
+	if procConfig.MaxMemoryRestart == "" {
+		return 0, nil
+	}
+
+	limit, err := utils.ParseSize(procConfig.MaxMemoryRestart)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max_memory_restart for process %s: %v", procConfig.Name, err)
+	}
+	return limit, nil
+}
+
+// treeRSS returns the resident memory of a process and all its descendants
+func treeRSS(pid int32, name string) uint64 {
+	var total uint64
+	for _, p := range append([]int32{pid}, findDescendants(pid, name)...) {
+		if rss, err := utils.GetProcessRSS(p); err == nil {
+			total += rss
+		}
+	}
+	return total
+}
+
+// startMemoryLimit starts watching the memory of a process that has a limit
+func (pm *ProcessManager) startMemoryLimit(proc *ManagedProcess) {
+	limit, err := maxMemory(proc.Config)
+	if err != nil || limit == 0 {
+		return
+	}
+
+	go pm.monitorMemory(proc, limit)
+}
+
+// monitorMemory restarts a process once it and its descendants use more than
+// limit bytes, until it exits
+func (pm *ProcessManager) monitorMemory(proc *ManagedProcess, limit uint64) {
+	name := proc.Config.Name
+
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-proc.done:
+			return
+		case <-ticker.C:
+		}
+
+		// Only a running process is sampled
+		proc.mu.RLock()
+		pid, status, stopping := proc.PID, proc.Status, proc.stopping
+		proc.mu.RUnlock()
+		if status != "running" || stopping {
+			continue
+		}
+
+		rss := treeRSS(int32(pid), name)
+		if rss <= limit {
+			continue
+		}
+
+		logrus.Warnf("Process %s uses %.1f MB, more than max_memory_restart %s, restarting it",
+			name, float64(rss)/(1024*1024), proc.Config.MaxMemoryRestart)
+		pm.restartWithReason(proc, memoryLimitReason, func(procState *ProcessState) {
+			procState.MemoryRestarts++
+		})
+		return
+	}
+}
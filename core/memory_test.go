@@ -0,0 +1,71 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prism/gem/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxMemoryRestart(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "bad-limit", Command: "sleep", Args: []string{"30"}, MaxMemoryRestart: "lots"})
+	assert.Error(t, err)
+
+	// A shell holding 32 MB in a variable is over the limit
+	proc, err := pm.StartProcess(&config.ProcessConfig{
+		Name:             "leaky",
+		Command:          "sh",
+		Args:             []string{"-c", `x=$(head -c 33554432 /dev/zero | tr '\0' a); sleep 30`},
+		MaxMemoryRestart: "16M",
+	})
+	assert.NoError(t, err)
+	pid := proc.PID
+
+	var restarting Event
+	timeout := time.After(3 * memoryCheckInterval)
+	for restarting.Type != EventRestarting {
+		select {
+		case restarting = <-sub.Events():
+		case <-timeout:
+			t.Fatal("process was not restarted")
+		}
+	}
+	assert.Equal(t, "memory limit", restarting.Reason)
+
+	// It is restarted gracefully and counted on its own
+	assert.Eventually(t, func() bool {
+		proc, err := pm.GetProcess("leaky")
+		return err == nil && proc.PID != pid
+	}, 5*time.Second, 50*time.Millisecond)
+
+	procState, _ := store.Get("leaky")
+	assert.Equal(t, 0, procState.Restarts)
+	assert.Equal(t, 1, procState.MemoryRestarts)
+	last := procState.ExitHistory[len(procState.ExitHistory)-1]
+	assert.Equal(t, "memory limit", last.Reason)
+	assert.Equal(t, "SIGTERM", last.Signal)
+
+	info, err := pm.GetProcessInfo("leaky")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, info.MemoryRestarts)
+	assert.Equal(t, "memory limit", info.LastExitReason)
+
+	assert.NoError(t, pm.StopProcess("leaky", false))
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// notifySocketPath returns where the notify socket of a process lives. The
+// path only depends on the name, so an adopted process can still reach it.
+func (pm *ProcessManager) notifySocketPath(name string) string {
+	return filepath.Join(filepath.Dir(pm.store.path), "notify", name+".sock")
+}
+
+// openNotifySocket creates the datagram socket a notify service reports its
+// state on, writable for the user the service runs as
+func (pm *ProcessManager) openNotifySocket(procConfig *config.ProcessConfig) (*net.UnixConn, error) {
+	name := procConfig.Name
+	path := pm.notifySocketPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	// The umask may have taken away the search permission other users need
+	if err := os.Chmod(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	// A socket left behind by an earlier instance is replaced
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notify socket for process %s: %v", name, err)
+	}
+
+	// Senders are identified by the credentials the kernel attaches
+	if err := enableCredentials(conn); err != nil {
+		conn.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to set up notify socket for process %s: %v", name, err)
+	}
+
+	if procConfig.User != "" {
+		credential, err := lookupCredential(procConfig.User, procConfig.Group)
+		if err == nil {
+			err = os.Chown(path, int(credential.Uid), int(credential.Gid))
+		}
+		if err != nil {
+			conn.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("failed to hand notify socket to user %s of process %s: %v", procConfig.User, name, err)
+		}
+	}
+	return conn, nil
+}
+
+// closeNotifySocket closes the notify socket of a process, if it has one
+func (proc *ManagedProcess) closeNotifySocket() {
+	proc.mu.Lock()
+	conn := proc.notify
+	proc.notify = nil
+	proc.mu.Unlock()
+
+	if conn != nil {
+		path := conn.LocalAddr().String()
+		conn.Close()
+		os.Remove(path)
+	}
+}
+
+// readNotify handles the messages a process sends to its notify socket until
+// the socket is closed
+func (pm *ProcessManager) readNotify(proc *ManagedProcess, conn *net.UnixConn) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, credentialsSize)
+	for {
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return
+		}
+		sender := messageSender(oob[:oobn])
+
+		// A message holds one KEY=VALUE assignment per line
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			pm.handleNotify(proc, key, value, sender)
+		}
+	}
+}
+
+// handleNotify applies one assignment from a notify message sent by the
+// process with PID sender, 0 when the sender isn't known
+func (pm *ProcessManager) handleNotify(proc *ManagedProcess, key, value string, sender int) {
+	name := proc.Config.Name
+
+	switch key {
+	case "READY":
+		if value != "1" {
+			return
+		}
+
+		proc.mu.Lock()
+		ready := proc.Status == "starting"
+		if ready {
+			proc.Status = "running"
+		}
+		pid := proc.PID
+		proc.mu.Unlock()
+		if !ready {
+			return
+		}
+
+		err := pm.store.UpdateProcess(name, func(procState *ProcessState) {
+			procState.Status = "running"
+		})
+		if err != nil {
+			logrus.Warnf("Failed to save state for process %s: %v", name, err)
+		}
+		pm.events.Publish(Event{Type: EventStarted, Process: name, PID: pid})
+		logrus.Infof("Process %s is ready", name)
+
+	case "STATUS":
+		proc.mu.Lock()
+		proc.statusText = value
+		proc.mu.Unlock()
+
+	case "WATCHDOG":
+		// "trigger" asks for the watchdog to act right away
+		proc.pingWatchdog(value == "1")
+
+	case "MAINPID":
+		pid, err := strconv.Atoi(value)
+		if err != nil || pid <= 0 {
+			logrus.Warnf("Process %s sent an invalid MAINPID %q", name, value)
+			return
+		}
+
+		// Only the process itself may name its main process
+		if !proc.owns(sender) {
+			logrus.Warnf("Ignoring MAINPID for process %s from PID %d, which isn't part of it", name, sender)
+			return
+		}
+
+		// The main process is stopped through its process group, so it
+		// has to be part of the service as well
+		if err := proc.validateMainPID(pid); err != nil {
+			logrus.Warnf("Process %s sent MAINPID %d, ignoring it: %v", name, pid, err)
+			return
+		}
+
+		proc.mu.Lock()
+		proc.mainPID = pid
+		proc.mu.Unlock()
+		logrus.Infof("Process %s reported main PID %d", name, pid)
+	}
+}
+
+// owns reports whether pid is the process, its main process or one of their
+// descendants
+func (proc *ManagedProcess) owns(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	proc.mu.RLock()
+	root, mainPID := proc.PID, proc.mainPID
+	proc.mu.RUnlock()
+	if pid == root || pid == mainPID {
+		return true
+	}
+
+	for _, descendant := range findDescendants(int32(root), proc.Config.Name) {
+		if int(descendant) == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// waitNotify waits for a notify service to exit. When the command it was
+// started with exits after reporting another process as MAINPID, that process
+// is tracked from then on.
+func (pm *ProcessManager) waitNotify(proc *ManagedProcess) error {
+	name := proc.Config.Name
+
+	err := waitCommand(proc.Cmd)
+
+	proc.mu.RLock()
+	cmdPID, mainPID := proc.PID, proc.mainPID
+	proc.mu.RUnlock()
+	if mainPID == 0 || mainPID == cmdPID || !processExists(mainPID) {
+		return err
+	}
+
+	fingerprint, fpErr := utils.GetProcessFingerprint(int32(mainPID))
+	if fpErr != nil {
+		return err
+	}
+
+	// From here on the main process is tracked like an adopted one
+	proc.mu.Lock()
+	proc.Cmd = nil
+	proc.PID = mainPID
+	proc.fingerprint = fingerprint
+	proc.mu.Unlock()
+
+	storeErr := pm.store.UpdateProcess(name, func(procState *ProcessState) {
+		procState.PID = mainPID
+		procState.Fingerprint = fingerprint
+	})
+	if storeErr != nil {
+		logrus.Warnf("Failed to save state for process %s: %v", name, storeErr)
+	}
+	logrus.Infof("Process %s continues with main PID %d", name, mainPID)
+
+	return waitMainProcess(mainPID)
+}
+
+// listenNotify attaches a notify socket to a process and handles the
+// messages sent to it
+func (pm *ProcessManager) listenNotify(proc *ManagedProcess, conn *net.UnixConn) {
+	proc.mu.Lock()
+	proc.notify = conn
+	proc.mu.Unlock()
+
+	go pm.readNotify(proc, conn)
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// credentialsSize is the room the credentials of a sender take in the
+// control data of a message
+var credentialsSize = unix.CmsgSpace(unix.SizeofUcred)
+
+// enableCredentials makes the kernel attach the credentials of the sender to
+// every message received on conn
+func enableCredentials(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// messageSender returns the PID of the sender of a message from its control
+// data, 0 when it isn't known
+func messageSender(oob []byte) int {
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, message := range messages {
+		if credentials, err := unix.ParseUnixCredentials(&message); err == nil {
+			return int(credentials.Pid)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package core
+
+import "net"
+
+// credentialsSize is 0, senders can't be identified on this platform
+const credentialsSize = 0
+
+// enableCredentials has nothing to do, senders can't be identified
+func enableCredentials(conn *net.UnixConn) error {
+	return nil
+}
+
+// messageSender doesn't know the sender of any message
+func messageSender(oob []byte) int {
+	return 0
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prism/gem/config"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyReadiness(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+
+	// The command hands over to a main process before it exits
+	pidFile := filepath.Join(tempDir, "main.pid")
+	proc, err := pm.StartProcess(&config.ProcessConfig{
+		Name:    "notifier",
+		Command: "sh",
+		Args:    []string{"-c", "sleep 30 & echo $! > " + pidFile + "; sleep 1"},
+		Type:    "notify",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "starting", proc.Status)
+
+	// The socket is handed to the process
+	socketPath := pm.notifySocketPath("notifier")
+	p, err := process.NewProcess(int32(proc.PID))
+	assert.NoError(t, err)
+	environ, err := p.Environ()
+	assert.NoError(t, err)
+	assert.Contains(t, environ, "NOTIFY_SOCKET="+socketPath)
+
+	notify := func(message string) {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+		assert.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(message))
+		assert.NoError(t, err)
+	}
+
+	// Only READY=1 makes it running
+	notify("STATUS=Warming up")
+	time.Sleep(200 * time.Millisecond)
+	info, err := pm.GetProcessInfo("notifier")
+	assert.NoError(t, err)
+	assert.Equal(t, "starting", info.Status)
+	assert.Equal(t, "Warming up", info.StatusText)
+
+	var mainPID int
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			return false
+		}
+		mainPID, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	notify("MAINPID=" + strconv.Itoa(mainPID))
+	notify("READY=1\nSTATUS=Serving")
+	timeout := time.After(5 * time.Second)
+	for started := false; !started; {
+		select {
+		case event := <-sub.Events():
+			started = event.Type == EventStarted
+		case <-timeout:
+			t.Fatal("process never became ready")
+		}
+	}
+
+	info, err = pm.GetProcessInfo("notifier")
+	assert.NoError(t, err)
+	assert.Equal(t, "running", info.Status)
+	assert.Equal(t, "Serving", info.StatusText)
+	procState, _ := store.Get("notifier")
+	assert.Equal(t, "running", procState.Status)
+
+	// The test isn't part of the process, so its MAINPID is ignored, and so
+	// are init and the daemon
+	proc.mu.RLock()
+	assert.Equal(t, 0, proc.mainPID)
+	proc.mu.RUnlock()
+	for _, pid := range []int{1, os.Getpid()} {
+		pm.handleNotify(proc, "MAINPID", strconv.Itoa(pid), proc.PID)
+	}
+	proc.mu.RLock()
+	assert.Equal(t, 0, proc.mainPID)
+	proc.mu.RUnlock()
+
+	// The command itself may name its main process
+	pm.handleNotify(proc, "MAINPID", strconv.Itoa(mainPID), proc.PID)
+
+	// Once the command exits the main process is supervised instead
+	assert.Eventually(t, func() bool {
+		proc.mu.RLock()
+		defer proc.mu.RUnlock()
+		return proc.PID == mainPID
+	}, 5*time.Second, 50*time.Millisecond)
+	procState, _ = store.Get("notifier")
+	assert.Equal(t, mainPID, procState.PID)
+
+	// Stopping it removes the socket
+	assert.NoError(t, pm.StopProcess("notifier", false))
+	assert.True(t, hasExited(int32(mainPID)))
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNotifySocketOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("handing the socket to another user needs root")
+	}
+
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+
+	// Create process manager
+	pm := NewProcessManager(store, filepath.Join(tempDir, "logs"))
+
+	// The socket belongs to the user the service runs as
+	conn, err := pm.openNotifySocket(&config.ProcessConfig{Name: "unprivileged", User: "nobody"})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	nobody, err := lookupCredential("nobody", "")
+	assert.NoError(t, err)
+	info, err := os.Stat(pm.notifySocketPath("unprivileged"))
+	assert.NoError(t, err)
+	assert.Equal(t, nobody.Uid, info.Sys().(*syscall.Stat_t).Uid)
+}
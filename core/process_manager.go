@@ -2,7 +2,9 @@ package core
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"os/user"
@@ -12,9 +14,8 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/creack/pty"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
+	"golang.org/x/sys/unix"
 
 	"github.com/prism/gem/config"
 	"github.com/prism/gem/utils"
@@ -22,86 +23,314 @@ import (
 
 // ProcessManager handles process lifecycle management
 type ProcessManager struct {
-	processes     map[string]*ManagedProcess
-	processesPath string
-	logsPath      string
-	mutex         sync.RWMutex
+	processes map[string]*ManagedProcess
+	store     *StateStore
+	logsPath  string
+	events    *EventBus
+	closing   bool            // Set on daemon shutdown, no process may start afterwards
+	starting  map[string]bool // Processes being spawned, not yet in processes
+	starts    sync.WaitGroup  // Spawns in progress, waited for on shutdown
+	mutex     sync.RWMutex
+
+	reloadMutex sync.Mutex // Serializes config reloads
+	cgroupRoot  string     // Gem's cgroup v2 subtree, empty without cgroups
+	cgroupFD    bool       // Processes start right in their cgroup, which needs Linux 5.7
 }
 
 // ManagedProcess represents a process managed by Gem
 type ManagedProcess struct {
 	Config       *config.ProcessConfig
-	Cmd          *exec.Cmd
+	Cmd          *exec.Cmd `json:"-"`
 	PID          int
-	Status       string // "running", "stopped", "restarting", "failed"
+	Status       string // "starting", "running", "stopping", "stopped", "restarting", "errored", "completed", "failed"
 	StartTime    time.Time
 	Restarts     int
-	LogFiles     map[string]*os.File
-	ClusterProcs []*ManagedProcess // For cluster mode
-	PTY          *os.File          // For interactive shell
+	Health       *utils.HealthState        `json:"health,omitempty"`
+	Adopted      bool                      // Running before the daemon started, so not our child
+	LogFiles     map[string]*os.File       `json:"-"`
+	ClusterProcs []*ManagedProcess         // For cluster mode
+	PTY          *os.File                  `json:"-"` // For interactive shell
+	stopping     bool                      // Set by StopProcess so the monitor doesn't restart
+	fingerprint  *utils.ProcessFingerprint // Identifies adopted processes across PID reuse
+	done         chan struct{}             // Closed once the monitor has handled the exit
+	stopCh       chan struct{}             // Closed by StopProcess, cuts a pending restart short
+	notify       *net.UnixConn             // Notify socket of a notify service
+	mainPID      int                       // MAINPID a notify service reported
+	statusText   string                    // STATUS a notify service reported
+	watchdog     chan bool                 // Pings from a process with a watchdog, false triggers it
+	killReason   string                    // Why Gem killed or stopped the process, recorded with its exit
+	restarting   bool                      // Set while Gem restarts the process, cleared by a stop from outside
+	cgroup       string                    // cgroup v2 of the process, empty without one
+	oomKills     uint64                    // OOM kills in the cgroup before the process started
 	mu           sync.RWMutex
 }
 
-// NewProcessManager creates a new process manager
-func NewProcessManager(processesPath, logsPath string) *ProcessManager {
+// NewProcessManager creates a new process manager that persists its state in store
+func NewProcessManager(store *StateStore, logsPath string) *ProcessManager {
 	return &ProcessManager{
-		processes:     make(map[string]*ManagedProcess),
-		processesPath: processesPath,
-		logsPath:      logsPath,
-		mutex:         sync.RWMutex{},
+		processes: make(map[string]*ManagedProcess),
+		starting:  make(map[string]bool),
+		store:     store,
+		logsPath:  logsPath,
+		events:    NewEventBus(),
+		mutex:     sync.RWMutex{},
 	}
 }
 
-// LoadRunningProcesses loads all running processes from PID files
+// Events returns the bus lifecycle events of all processes are published on
+func (pm *ProcessManager) Events() *EventBus {
+	return pm.events
+}
+
+// LoadRunningProcesses adopts the processes recorded as running in the state
+// store and lists the ones that gave up restarting again
 func (pm *ProcessManager) LoadRunningProcesses() error {
-	runningProcesses, err := utils.GetRunningProcesses(pm.processesPath)
-	if err != nil {
-		return err
-	}
+	for name, procState := range pm.store.List() {
+		if procState.Config == nil {
+			continue
+		}
 
-	for name, pid := range runningProcesses {
-		configPath := filepath.Join(pm.processesPath, fmt.Sprintf("%s.gem", name))
-		if _, err := os.Stat(configPath); os.IsNotExist(err) {
-			logrus.Warnf("Process %s is running but no config file found", name)
+		// An errored process stays listed until it is started or stopped again,
+		// there is nothing to supervise
+		if procState.Status == "errored" {
+			done := make(chan struct{})
+			close(done)
+
+			pm.mutex.Lock()
+			pm.processes[name] = &ManagedProcess{
+				Config:    procState.Config,
+				Status:    "errored",
+				StartTime: procState.StartTime,
+				Restarts:  procState.Restarts,
+				LogFiles:  make(map[string]*os.File),
+				done:      done,
+				stopCh:    make(chan struct{}),
+			}
+			pm.mutex.Unlock()
 			continue
 		}
 
-		procConfig, err := config.LoadProcessConfig(configPath)
-		if err != nil {
-			logrus.Warnf("Failed to load config for process %s: %v", name, err)
+		// A restart that was pending when the daemon went down goes ahead,
+		// workers come back with their cluster
+		if procState.Status == "restarting" && procState.Cluster == "" {
+			pm.resumeRestart(name, procState)
+			continue
+		}
+
+		if procState.PID == 0 {
+			continue
+		}
+
+		// Never adopt a process that merely reuses the recorded PID
+		pid := int32(procState.PID)
+		if procState.Fingerprint == nil || !utils.IsProcessRunning(pid, procState.Fingerprint) {
+			if utils.IsProcessRunning(pid, nil) {
+				logrus.Warnf("Stale state for %s: PID %d now belongs to another process", name, pid)
+			}
+			pm.recordStopped(name, ExitRecord{Time: time.Now(), PID: procState.PID, ExitCode: -1, Reason: "exited while the daemon was down"})
 			continue
 		}
 
 		proc := &ManagedProcess{
-			Config:    procConfig,
-			PID:       int(pid),
-			Status:    "running",
-			StartTime: time.Now(), // Approximate
-			LogFiles:  make(map[string]*os.File),
+			Config:      procState.Config,
+			PID:         procState.PID,
+			Status:      "running",
+			StartTime:   time.UnixMilli(procState.Fingerprint.StartTime),
+			Restarts:    procState.Restarts,
+			Adopted:     true,
+			LogFiles:    make(map[string]*os.File),
+			fingerprint: procState.Fingerprint,
+			done:        make(chan struct{}),
+			stopCh:      make(chan struct{}),
 		}
 
 		pm.mutex.Lock()
 		pm.processes[name] = proc
+
+		// The process is still in the cgroup it was started in
+		if pm.cgroupRoot != "" {
+			dir := pm.cgroupPath(name)
+			if _, err := os.Stat(dir); err == nil {
+				proc.cgroup = dir
+				proc.oomKills = readOOMKills(dir)
+			}
+		}
 		pm.mutex.Unlock()
 
-		logrus.Infof("Loaded running process: %s (PID: %d)", name, pid)
+		// A notify service keeps reporting on the socket it was given
+		if procState.Config.Type == "notify" {
+			conn, err := pm.openNotifySocket(procState.Config)
+			if err != nil {
+				logrus.Warnf("Process %s: %v", name, err)
+			} else {
+				pm.listenNotify(proc, conn)
+			}
+		}
+
+		// Supervise the adopted process like one we started
+		go pm.monitorProcess(proc)
+		pm.startHealthCheck(proc)
+		pm.startWatchdog(proc)
+		pm.startMemoryLimit(proc)
+
+		logrus.Infof("Adopted running process: %s (PID: %d)", name, pid)
+	}
+
+	// Rebuild cluster masters around their adopted workers
+	for name, procState := range pm.store.List() {
+		if procState.Cluster == "" {
+			continue
+		}
+
+		worker, err := pm.GetProcess(name)
+		if err != nil {
+			continue
+		}
+
+		pm.mutex.Lock()
+		master, exists := pm.processes[procState.Cluster]
+		if !exists {
+			if masterState, ok := pm.store.Get(procState.Cluster); ok {
+				master = &ManagedProcess{
+					Config:    masterState.Config,
+					Status:    "running",
+					StartTime: masterState.StartTime,
+				}
+				pm.processes[procState.Cluster] = master
+			}
+		}
+		if master != nil {
+			master.ClusterProcs = append(master.ClusterProcs, worker)
+		}
+		pm.mutex.Unlock()
 	}
 
 	return nil
 }
 
-// StartProcess starts a new process
+// resumeRestart restarts a process that was waiting out its restart delay
+// when the daemon went down, once the rest of the delay has passed
+func (pm *ProcessManager) resumeRestart(name string, procState *ProcessState) {
+	var delay time.Duration
+	if procState.Backoff != nil {
+		delay = max(time.Until(procState.Backoff.NextRestart), 0)
+	}
+
+	proc := &ManagedProcess{
+		Config:    procState.Config,
+		Status:    "restarting",
+		StartTime: procState.StartTime,
+		Restarts:  procState.Restarts,
+		LogFiles:  make(map[string]*os.File),
+		done:      make(chan struct{}),
+		stopCh:    make(chan struct{}),
+	}
+	pm.mutex.Lock()
+	pm.processes[name] = proc
+	pm.mutex.Unlock()
+
+	go func() {
+		defer close(proc.done)
+		pm.restartAfter(proc, delay, "exited")
+	}()
+	logrus.Infof("Resuming the restart of process %s in %s", name, delay.Round(time.Second))
+}
+
+// StartProcess starts a new process once its dependencies meet their
+// conditions, starting the dependencies that aren't running yet
 func (pm *ProcessManager) StartProcess(procConfig *config.ProcessConfig) (*ManagedProcess, error) {
+	if err := pm.startDependencies(procConfig); err != nil {
+		return nil, err
+	}
+
+	return pm.startProcess(procConfig)
+}
+
+// startProcess starts a process without its dependencies
+func (pm *ProcessManager) startProcess(procConfig *config.ProcessConfig) (*ManagedProcess, error) {
 	pm.mutex.Lock()
-	defer pm.mutex.Unlock()
+	err := pm.reserveStart(procConfig)
+	pm.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return pm.spawnProcess(procConfig)
+}
 
-	// Check if process already exists
+// reserveStart checks that a process may start and keeps any other start of
+// it out until spawnProcess is done. The caller must hold pm.mutex.
+func (pm *ProcessManager) reserveStart(procConfig *config.ProcessConfig) error {
+	if pm.closing {
+		return fmt.Errorf("cannot start process %s, the daemon is shutting down", procConfig.Name)
+	}
+	if err := validateProcess(procConfig); err != nil {
+		return err
+	}
+
+	// Only one instance of a process may exist until it is done
+	if pm.starting[procConfig.Name] {
+		return fmt.Errorf("process %s is already starting", procConfig.Name)
+	}
 	if proc, exists := pm.processes[procConfig.Name]; exists {
-		if proc.Status == "running" {
-			return nil, fmt.Errorf("process %s is already running", procConfig.Name)
+		proc.mu.RLock()
+		status := proc.Status
+		proc.mu.RUnlock()
+		if !IsTerminalStatus(status) {
+			return fmt.Errorf("process %s is already %s", procConfig.Name, status)
 		}
 	}
 
+	pm.starting[procConfig.Name] = true
+	pm.starts.Add(1)
+	return nil
+}
+
+// validateProcess checks the settings of a process before it starts
+func validateProcess(procConfig *config.ProcessConfig) error {
+	if err := validateProcessType(procConfig); err != nil {
+		return err
+	}
+	if _, err := stopSignal(procConfig); err != nil {
+		return err
+	}
+	if _, err := reloadSignal(procConfig); err != nil {
+		return err
+	}
+	if err := validateBackoff(procConfig); err != nil {
+		return err
+	}
+	if err := validateExitPolicy(procConfig); err != nil {
+		return err
+	}
+	if err := validateDependencies(procConfig); err != nil {
+		return err
+	}
+	if err := validateHealthCheck(procConfig); err != nil {
+		return err
+	}
+	if err := validateWatchdog(procConfig); err != nil {
+		return err
+	}
+	if _, err := maxMemory(procConfig); err != nil {
+		return err
+	}
+	return validateResources(procConfig)
+}
+
+// spawnProcess starts a process reserved with reserveStart. pm.mutex is only
+// taken to add the process, so a slow pre_start script holds up neither other
+// starts nor the API.
+func (pm *ProcessManager) spawnProcess(procConfig *config.ProcessConfig) (*ManagedProcess, error) {
+	defer func() {
+		pm.mutex.Lock()
+		delete(pm.starting, procConfig.Name)
+		pm.mutex.Unlock()
+		pm.starts.Done()
+	}()
+
+	pm.events.Publish(Event{Type: EventStarting, Process: procConfig.Name})
+
 	// Handle cluster mode
 	if procConfig.Cluster.Instances > 1 {
 		return pm.startClusterProcess(procConfig)
@@ -110,6 +339,7 @@ func (pm *ProcessManager) StartProcess(procConfig *config.ProcessConfig) (*Manag
 	// Run pre-start script if defined
 	if procConfig.Scripts.PreStart != "" {
 		if err := runScript(procConfig.Scripts.PreStart); err != nil {
+			pm.publishHookFailed(procConfig.Name, "pre_start", err)
 			return nil, fmt.Errorf("pre-start script failed: %v", err)
 		}
 	}
@@ -123,10 +353,10 @@ func (pm *ProcessManager) StartProcess(procConfig *config.ProcessConfig) (*Manag
 	}
 
 	// Set environment variables
-	cmd.Env = os.Environ()
-	for k, v := range procConfig.Environment {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-	}
+	cmd.Env = processEnvironment(procConfig)
+
+	// Mark the process so its descendants can be traced back to it
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", processEnvMarker, procConfig.Name))
 
 	// Set up user/group if specified
 	if procConfig.User != "" {
@@ -135,6 +365,16 @@ func (pm *ProcessManager) StartProcess(procConfig *config.ProcessConfig) (*Manag
 		}
 	}
 
+	// Run the process in its own group so it can be signalled as a whole
+	setProcessGroup(cmd, procConfig)
+
+	// A stale pid file would point a forking service at the wrong process
+	if procConfig.Type == "forking" && procConfig.PIDFile != "" {
+		if err := os.Remove(pidFilePath(procConfig)); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale pid file: %v", err)
+		}
+	}
+
 	// Set up logging
 	logFiles, err := setupLogging(procConfig, pm.logsPath)
 	if err != nil {
@@ -146,47 +386,103 @@ func (pm *ProcessManager) StartProcess(procConfig *config.ProcessConfig) (*Manag
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
+	// A notify service reports its state on a socket of its own
+	var notifyConn *net.UnixConn
+	if procConfig.Type == "notify" {
+		notifyConn, err = pm.openNotifySocket(procConfig)
+		if err != nil {
+			closeLogFiles(logFiles)
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("NOTIFY_SOCKET=%s", pm.notifySocketPath(procConfig.Name)))
+		if procConfig.WatchdogSec > 0 {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("WATCHDOG_USEC=%d", watchdogTimeout(procConfig).Microseconds()))
+		}
+	}
+
+	// Put the process in a cgroup of its own, with its resource limits
+	cgroup, cgroupFile := pm.setupCgroup(cmd, procConfig)
+
 	// Start the process
-	if err := cmd.Start(); err != nil {
+	err = startCommand(cmd)
+	if cgroupFile != nil {
+		cgroupFile.Close()
+	}
+	if err != nil {
 		closeLogFiles(logFiles)
+		if notifyConn != nil {
+			notifyConn.Close()
+		}
 		return nil, err
 	}
+	if cgroup != "" && cgroupFile == nil {
+		cgroup = moveToCgroup(procConfig.Name, cgroup, cmd.Process.Pid)
+	}
 
-	// Create managed process
+	// Create managed process, a forking service is starting until its main
+	// process is known and a notify service until it reports it is ready
+	status := "running"
+	if procConfig.Type == "forking" || procConfig.Type == "notify" {
+		status = "starting"
+	}
 	proc := &ManagedProcess{
 		Config:    procConfig,
 		Cmd:       cmd,
 		PID:       cmd.Process.Pid,
-		Status:    "running",
+		Status:    status,
 		StartTime: time.Now(),
 		LogFiles:  logFiles,
+		done:      make(chan struct{}),
+		stopCh:    make(chan struct{}),
+		cgroup:    cgroup,
+		oomKills:  readOOMKills(cgroup),
 	}
 
-	// Save PID file
-	if err := utils.WritePIDFile(proc.PID, procConfig.Name, pm.processesPath); err != nil {
-		logrus.Warnf("Failed to write PID file: %v", err)
-	}
-
-	// Save config file
-	configPath := filepath.Join(pm.processesPath, fmt.Sprintf("%s.gem", procConfig.Name))
-	if err := saveConfigFile(procConfig, configPath); err != nil {
-		logrus.Warnf("Failed to save config file: %v", err)
+	// Persist the config and PID so a restarted daemon can adopt the process
+	fingerprint, err := utils.GetProcessFingerprint(int32(proc.PID))
+	if err != nil {
+		logrus.Warnf("Failed to fingerprint process %s: %v", procConfig.Name, err)
+	}
+	err = pm.store.UpdateProcess(procConfig.Name, func(procState *ProcessState) {
+		procState.Config = procConfig
+		procState.Status = status
+		procState.PID = proc.PID
+		procState.Fingerprint = fingerprint
+		procState.StartTime = proc.StartTime
+
+		// The restart count outlives the instances of the process
+		proc.Restarts = procState.Restarts
+	})
+	if err != nil {
+		logrus.Warnf("Failed to save state for process %s: %v", procConfig.Name, err)
 	}
 
 	// Store process
+	pm.mutex.Lock()
 	pm.processes[procConfig.Name] = proc
+	pm.mutex.Unlock()
+	if notifyConn != nil {
+		pm.listenNotify(proc, notifyConn)
+	}
+	if status == "running" {
+		pm.events.Publish(Event{Type: EventStarted, Process: procConfig.Name, PID: proc.PID})
+	}
 
 	// Run post-start script if defined
 	if procConfig.Scripts.PostStart != "" {
 		go func() {
 			if err := runScript(procConfig.Scripts.PostStart); err != nil {
 				logrus.Warnf("Post-start script failed: %v", err)
+				pm.publishHookFailed(procConfig.Name, "post_start", err)
 			}
 		}()
 	}
 
 	// Monitor process in background
 	go pm.monitorProcess(proc)
+	pm.startHealthCheck(proc)
+	pm.startWatchdog(proc)
+	pm.startMemoryLimit(proc)
 
 	return proc, nil
 }
@@ -214,19 +510,39 @@ func (pm *ProcessManager) startClusterProcess(procConfig *config.ProcessConfig)
 		instanceConfig.Cluster.Instances = 0 // Prevent recursive cluster creation
 
 		// Start the worker process
-		proc, err := pm.StartProcess(&instanceConfig)
+		proc, err := pm.startProcess(&instanceConfig)
 		if err != nil {
 			logrus.Errorf("Failed to start worker %d for cluster %s: %v", i, procConfig.Name, err)
 			continue
 		}
 
+		// Record which cluster the worker belongs to
+		err = pm.store.UpdateProcess(instanceConfig.Name, func(procState *ProcessState) {
+			procState.Cluster = procConfig.Name
+		})
+		if err != nil {
+			logrus.Warnf("Failed to save state for worker %s: %v", instanceConfig.Name, err)
+		}
+
 		// Add to cluster processes
 		masterProc.ClusterProcs = append(masterProc.ClusterProcs, proc)
 	}
 
 	// Store master process
+	pm.mutex.Lock()
 	pm.processes[procConfig.Name] = masterProc
+	pm.mutex.Unlock()
 
+	err := pm.store.UpdateProcess(procConfig.Name, func(procState *ProcessState) {
+		procState.Config = procConfig
+		procState.Status = "running"
+		procState.StartTime = masterProc.StartTime
+	})
+	if err != nil {
+		logrus.Warnf("Failed to save state for cluster %s: %v", procConfig.Name, err)
+	}
+
+	pm.events.Publish(Event{Type: EventStarted, Process: procConfig.Name})
 	logrus.Infof("Started cluster %s with %d instances", procConfig.Name, len(masterProc.ClusterProcs))
 	return masterProc, nil
 }
@@ -241,13 +557,31 @@ func (pm *ProcessManager) StopProcess(name string, force bool) error {
 		return fmt.Errorf("process %s not found", name)
 	}
 
-	// Handle cluster mode
+	// A restart Gem has under way doesn't start the process again
+	proc.mu.Lock()
+	proc.restarting = false
+	proc.mu.Unlock()
+
+	return pm.stopProcess(proc, force)
+}
+
+// stopProcess stops a process and waits for it to exit
+func (pm *ProcessManager) stopProcess(proc *ManagedProcess, force bool) error {
+	name := proc.Config.Name
+
+	// Handle cluster mode, the workers are stopped all at once
 	if len(proc.ClusterProcs) > 0 {
+		var wg sync.WaitGroup
 		for _, workerProc := range proc.ClusterProcs {
-			if err := pm.StopProcess(workerProc.Config.Name, force); err != nil {
-				logrus.Warnf("Failed to stop worker %s: %v", workerProc.Config.Name, err)
-			}
+			wg.Add(1)
+			go func(workerName string) {
+				defer wg.Done()
+				if err := pm.StopProcess(workerName, force); err != nil {
+					logrus.Warnf("Failed to stop worker %s: %v", workerName, err)
+				}
+			}(workerProc.Config.Name)
 		}
+		wg.Wait()
 
 		// Update master process status
 		proc.mu.Lock()
@@ -259,59 +593,131 @@ func (pm *ProcessManager) StopProcess(name string, force bool) error {
 		delete(pm.processes, name)
 		pm.mutex.Unlock()
 
+		pm.recordStopped(name, ExitRecord{})
+		pm.events.Publish(Event{Type: EventStopped, Process: name})
+
+		return nil
+	}
+
+	// A process that gave up restarting only has to be cleared
+	select {
+	case <-proc.done:
+		pm.removeProcess(proc)
+		pm.recordStopped(name, ExitRecord{})
+		pm.events.Publish(Event{Type: EventStopped, Process: name})
 		return nil
+	default:
 	}
 
 	// Run pre-stop script if defined
 	if proc.Config.Scripts.PreStop != "" {
 		if err := runScript(proc.Config.Scripts.PreStop); err != nil {
 			logrus.Warnf("Pre-stop script failed: %v", err)
+			pm.publishHookFailed(name, "pre_stop", err)
 		}
 	}
 
-	// Stop the process
-	var err error
-	if force {
-		err = proc.Cmd.Process.Kill()
-	} else {
-		err = proc.Cmd.Process.Signal(syscall.SIGTERM)
+	// Mark the process as stopping so the monitor cleans up instead of restarting
+	proc.mu.Lock()
+	if !proc.stopping && proc.stopCh != nil {
+		close(proc.stopCh)
+	}
+	proc.stopping = true
+	if proc.Status == "running" || proc.Status == "starting" {
+		proc.Status = "stopping"
 	}
+	proc.mu.Unlock()
 
-	if err != nil {
-		return err
+	// Stop the process and whatever else runs in its group
+	sig := syscall.SIGKILL
+	if !force {
+		var err error
+		if sig, err = stopSignal(proc.Config); err != nil {
+			logrus.Warnf("%v, using SIGTERM", err)
+			sig = syscall.SIGTERM
+		}
+	}
+	if err := proc.signalGroup(sig); err != nil {
+		// It may have exited on its own already, the monitor tells
+		logrus.Debugf("Failed to signal process %s: %v", name, err)
 	}
 
-	// Update process status
-	proc.mu.Lock()
-	proc.Status = "stopped"
-	proc.mu.Unlock()
+	// It only counts as stopped once it has exited
+	return pm.waitStopped(proc, killTimeout(proc.Config))
+}
 
-	// Wait for process to exit
-	go func() {
-		proc.Cmd.Wait()
+// waitStopped waits up to timeout for a stopped process to exit and kills it
+// when it doesn't
+func (pm *ProcessManager) waitStopped(proc *ManagedProcess, timeout time.Duration) error {
+	name := proc.Config.Name
 
-		// Close log files
-		closeLogFiles(proc.LogFiles)
+	select {
+	case <-proc.done:
+		return nil
+	case <-time.After(timeout):
+	}
 
-		// Delete PID file
-		utils.DeletePIDFile(name, pm.processesPath)
+	logrus.Warnf("Process %s did not exit within %s, killing it", name, timeout)
+	if err := proc.signalGroup(syscall.SIGKILL); err != nil {
+		logrus.Warnf("Failed to kill process %s: %v", name, err)
+	}
 
-		// Run post-stop script if defined
-		if proc.Config.Scripts.PostStop != "" {
-			if err := runScript(proc.Config.Scripts.PostStop); err != nil {
-				logrus.Warnf("Post-stop script failed: %v", err)
+	select {
+	case <-proc.done:
+		return nil
+	case <-time.After(killWait):
+		return fmt.Errorf("process %s did not exit after SIGKILL", name)
+	}
+}
+
+// SignalProcess sends a signal to a process, or to every worker of a cluster
+func (pm *ProcessManager) SignalProcess(name string, sig syscall.Signal) error {
+	proc, err := pm.GetProcess(name)
+	if err != nil {
+		return err
+	}
+
+	// Handle cluster mode
+	if len(proc.ClusterProcs) > 0 {
+		var errs []error
+		for _, workerProc := range proc.ClusterProcs {
+			if err := pm.SignalProcess(workerProc.Config.Name, sig); err != nil {
+				logrus.Warnf("Failed to signal worker %s: %v", workerProc.Config.Name, err)
+				errs = append(errs, err)
 			}
 		}
+		return errors.Join(errs...)
+	}
 
-		// Remove from processes map
-		pm.mutex.Lock()
-		delete(pm.processes, name)
-		pm.mutex.Unlock()
+	logrus.Infof("Sending %s to process %s", unix.SignalName(sig), name)
+	return proc.signal(sig)
+}
 
-		logrus.Infof("Process %s stopped", name)
-	}()
+// ReloadProcess asks a process to reload its configuration by sending it its
+// reload signal, or every worker of a cluster theirs
+func (pm *ProcessManager) ReloadProcess(name string) error {
+	proc, err := pm.GetProcess(name)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	// Handle cluster mode
+	if len(proc.ClusterProcs) > 0 {
+		var errs []error
+		for _, workerProc := range proc.ClusterProcs {
+			if err := pm.ReloadProcess(workerProc.Config.Name); err != nil {
+				logrus.Warnf("Failed to reload worker %s: %v", workerProc.Config.Name, err)
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	sig, err := reloadSignal(proc.Config)
+	if err != nil {
+		return err
+	}
+	return pm.SignalProcess(name, sig)
 }
 
 // RestartProcess restarts a running process
@@ -334,19 +740,66 @@ func (pm *ProcessManager) RestartProcess(name string) error {
 		return nil
 	}
 
-	// Stop the process
+	pm.events.Publish(Event{Type: EventRestarting, Process: name, Reason: "restart requested"})
+
+	// Stop the process, this returns once it has exited
 	if err := pm.StopProcess(name, false); err != nil {
 		return err
 	}
 
-	// Wait a moment for the process to stop
-	time.Sleep(time.Duration(proc.Config.RestartDelay) * time.Second)
-
 	// Start the process again
 	_, err := pm.StartProcess(proc.Config)
 	return err
 }
 
+// restartWithReason gracefully restarts a process Gem found misbehaving. The
+// reason is recorded with its exit and count updates its restart counters.
+func (pm *ProcessManager) restartWithReason(proc *ManagedProcess, reason string, count func(procState *ProcessState)) {
+	name := proc.Config.Name
+
+	proc.mu.Lock()
+	if proc.stopping {
+		// Stopped from outside already, there's nothing to restart
+		proc.mu.Unlock()
+		return
+	}
+	proc.killReason = reason
+	proc.restarting = true
+	proc.mu.Unlock()
+
+	pm.events.Publish(Event{Type: EventRestarting, Process: name, Reason: reason})
+	if err := pm.stopProcess(proc, false); err != nil {
+		logrus.Errorf("Failed to stop process %s: %v", name, err)
+		return
+	}
+
+	// The process may have been stopped or replaced from outside meanwhile,
+	// it is only started again when neither happened
+	pm.mutex.Lock()
+	proc.mu.RLock()
+	restarting := proc.restarting
+	proc.mu.RUnlock()
+	if _, replaced := pm.processes[name]; replaced || pm.starting[name] || !restarting {
+		pm.mutex.Unlock()
+		logrus.Infof("Not restarting process %s, it was stopped or replaced", name)
+		return
+	}
+	err := pm.reserveStart(proc.Config)
+	pm.mutex.Unlock()
+	if err != nil {
+		logrus.Errorf("Failed to restart process %s: %v", name, err)
+		return
+	}
+
+	if err := pm.store.UpdateProcess(name, count); err != nil {
+		logrus.Warnf("Failed to save state for process %s: %v", name, err)
+	}
+
+	if _, err := pm.spawnProcess(proc.Config); err != nil {
+		logrus.Errorf("Failed to restart process %s: %v", name, err)
+	}
+}
+
 // GetProcess returns a process by name
 func (pm *ProcessManager) GetProcess(name string) (*ManagedProcess, error) {
 	pm.mutex.RLock()
@@ -384,19 +837,62 @@ func (pm *ProcessManager) GetProcessInfo(name string) (*utils.ProcessInfo, error
 	if len(proc.ClusterProcs) > 0 {
 		// Get info for master process
 		info := &utils.ProcessInfo{
-			Name:      proc.Config.Name,
-			Status:    proc.Status,
-			StartTime: proc.StartTime,
-			Uptime:    time.Since(proc.StartTime).Round(time.Second).String(),
-			Command:   proc.Config.Command,
-			Instances: len(proc.ClusterProcs),
+			Name:        proc.Config.Name,
+			Status:      proc.Status,
+			StartTime:   proc.StartTime,
+			Uptime:      time.Since(proc.StartTime).Round(time.Second).String(),
+			Command:     proc.Config.Command,
+			Restarts:    proc.Restarts,
+			Instances:   len(proc.ClusterProcs),
+			ClusterMode: proc.Config.Cluster.Mode,
+			Environment: proc.Config.Environment,
+			DependsOn:   pm.dependencyGraph(proc.Config, nil),
+			RequiredBy:  pm.dependents(name),
+		}
+
+		// Add worker info
+		for _, worker := range proc.ClusterProcs {
+			workerInfo, err := pm.GetProcessInfo(worker.Config.Name)
+			if err != nil {
+				continue
+			}
+			info.Workers = append(info.Workers, workerInfo)
 		}
 
 		return info, nil
 	}
 
-	// Get detailed process info
-	return utils.GetProcessInfo(int32(proc.PID))
+	// Get detailed process info, a process waiting to be restarted or one
+	// that gave up has none
+	proc.mu.RLock()
+	pid, status, restarts, statusText := proc.PID, proc.Status, proc.Restarts, proc.statusText
+	proc.mu.RUnlock()
+	info, err := utils.GetProcessInfo(int32(pid))
+	if err != nil {
+		info = &utils.ProcessInfo{Command: proc.Config.Command}
+	} else {
+		info.Descendants = findDescendants(int32(pid), proc.Config.Name)
+	}
+
+	// Add what only Gem knows about the process
+	info.Name = proc.Config.Name
+	info.Status = status
+	info.StatusText = statusText
+	info.Restarts = restarts
+	info.Cgroup = proc.cgroup
+	if procState, ok := pm.store.Get(name); ok {
+		info.MemoryRestarts = procState.MemoryRestarts
+		if len(procState.ExitHistory) > 0 {
+			info.LastExitReason = procState.ExitHistory[len(procState.ExitHistory)-1].Reason
+		}
+	}
+	info.Environment = proc.Config.Environment
+	info.Backoff = pm.backoffState(proc)
+	info.Health = proc.healthState()
+	info.DependsOn = pm.dependencyGraph(proc.Config, nil)
+	info.RequiredBy = pm.dependents(name)
+
+	return info, nil
 }
 
 // AttachShell attaches an interactive shell to a running process
@@ -429,11 +925,14 @@ func (pm *ProcessManager) AttachShell(name string) (*os.File, error) {
 	}
 
 	// Create a pseudoterminal
-	ptmx, err := pty.Start(cmd)
+	ptmx, err := startCommandPTY(cmd)
 	if err != nil {
 		return nil, err
 	}
 
+	// Reap the shell once it exits
+	go waitCommand(cmd)
+
 	// Store the PTY
 	proc.mu.Lock()
 	proc.PTY = ptmx
@@ -496,54 +995,422 @@ func (pm *ProcessManager) GetLogs(name string, stream string, lines int) ([]stri
 
 // monitorProcess monitors a process and handles restarts
 func (pm *ProcessManager) monitorProcess(proc *ManagedProcess) {
-	// Wait for the process to exit
-	err := proc.Cmd.Wait()
+	defer close(proc.done)
+
+	// A forking service is tracked through its main process once the command
+	// it was started with has exited, a notify service through the MAINPID
+	// it reported
+	var err error
+	switch {
+	case proc.Config.Type == "forking" && proc.Cmd != nil:
+		err = pm.waitForking(proc)
+		if err == nil {
+			err = proc.wait()
+		}
+	case proc.Config.Type == "notify" && proc.Cmd != nil:
+		err = pm.waitNotify(proc)
+	default:
+		// Wait for the process to exit
+		err = proc.wait()
+	}
+	proc.closeNotifySocket()
+	exit := exitRecord(proc.PID, err)
+
+	// An OOM kill leaves its trace in the cgroup of the process
+	exitReason := ""
+	if proc.oomKilled() {
+		exitReason = oomKillReason
+		logrus.Warnf("Process %s was killed by the OOM killer", proc.Config.Name)
+	}
 
 	// Process has exited
 	proc.mu.Lock()
 	proc.Status = "stopped"
+	stopping := proc.stopping
+	killReason := proc.killReason
 	proc.mu.Unlock()
 
 	// Close log files
 	closeLogFiles(proc.LogFiles)
 
-	// Check if we should restart the process
-	shouldRestart := false
-	if proc.Config.Restart == "always" {
-		shouldRestart = true
-	} else if proc.Config.Restart == "on-failure" && err != nil {
-		shouldRestart = true
+	pm.events.Publish(Event{
+		Type:     EventExited,
+		Process:  proc.Config.Name,
+		Time:     exit.Time,
+		PID:      exit.PID,
+		ExitCode: exit.ExitCode,
+		Signal:   exit.Signal,
+		Reason:   exitReason,
+	})
+
+	// Process was stopped on request, clean up without restarting
+	if stopping {
+		// Whatever the process left behind goes with it
+		killDescendants(proc.Config.Name)
+
+		exit.Reason = "stopped"
+		if killReason != "" {
+			exit.Reason = killReason
+		}
+		if pm.isCurrent(proc) {
+			pm.recordStopped(proc.Config.Name, exit)
+		}
+
+		// Run post-stop script if defined
+		if proc.Config.Scripts.PostStop != "" {
+			if err := runScript(proc.Config.Scripts.PostStop); err != nil {
+				logrus.Warnf("Post-stop script failed: %v", err)
+				pm.publishHookFailed(proc.Config.Name, "post_stop", err)
+			}
+		}
+
+		pm.removeProcess(proc)
+		pm.events.Publish(Event{Type: EventStopped, Process: proc.Config.Name})
+
+		logrus.Infof("Process %s stopped", proc.Config.Name)
+		return
 	}
 
-	// Check max restarts
-	if shouldRestart && (proc.Config.MaxRestarts == 0 || proc.Restarts < proc.Config.MaxRestarts) {
-		logrus.Infof("Process %s exited, restarting in %d seconds", proc.Config.Name, proc.Config.RestartDelay)
+	// Check if we should restart the process, a oneshot that succeeded is done
+	clean := cleanExit(proc.Config, exit)
+	completed := proc.Config.Type == "oneshot" && clean
+	shouldRestart := restartWanted(proc.Config, exit, clean, completed)
+
+	// A process Gem killed because it hung is always restarted
+	if killReason != "" {
+		shouldRestart = true
+	}
 
-		// Wait before restarting
-		time.Sleep(time.Duration(proc.Config.RestartDelay) * time.Second)
+	// Any other process that succeeded and isn't restarted is done as well
+	if clean && !shouldRestart {
+		completed = true
+	}
 
-		// Increment restart counter
-		proc.mu.Lock()
-		proc.Restarts++
-		proc.mu.Unlock()
+	// Nothing is restarted while the daemon shuts down
+	pm.mutex.RLock()
+	if pm.closing {
+		shouldRestart = false
+	}
+	pm.mutex.RUnlock()
 
-		// Restart the process
-		_, err := pm.StartProcess(proc.Config)
+	// Exits sooner than min_uptime count toward the unstable restart budget of
+	// max_restarts, a run that lasted longer starts it over
+	var previous *utils.BackoffState
+	unstableRestarts := 0
+	if procState, exists := pm.store.Get(proc.Config.Name); exists {
+		previous = procState.Backoff
+		unstableRestarts = procState.UnstableRestarts
+	}
+	uptime := exit.Time.Sub(proc.StartTime)
+	unstable := uptime < minUptime(proc.Config)
+	if !unstable {
+		unstableRestarts = 0
+	}
+	exhausted := shouldRestart && unstable && proc.Config.MaxRestarts != 0 && unstableRestarts >= proc.Config.MaxRestarts
+	if unstable {
+		unstableRestarts++
+	}
+
+	if exhausted {
+		// The process keeps crashing right after it starts, give up on it
+		logrus.Errorf("Process %s exited within min_uptime %d times in a row, giving up", proc.Config.Name, unstableRestarts)
+		exit.Reason = "errored"
+		pm.recordErrored(proc, exit)
+		pm.events.Publish(Event{Type: EventGaveUp, Process: proc.Config.Name, Reason: "max restarts reached"})
+	} else if shouldRestart {
+		// The delay grows while the process keeps crashing
+		backoff := nextBackoff(proc.Config, previous, uptime)
+		backoff.NextRestart = time.Now().Add(backoff.Delay)
+		logrus.Infof("Process %s exited, restarting in %s (attempt %d)", proc.Config.Name, backoff.Delay, backoff.Attempt)
+
+		exit.Reason = "restarted"
+		restartReason := "exited"
+		if exitReason != "" {
+			exit.Reason = exitReason
+			restartReason = exitReason
+		}
+		if killReason != "" {
+			exit.Reason = killReason
+			restartReason = killReason
+		}
+		err := pm.store.UpdateProcess(proc.Config.Name, func(procState *ProcessState) {
+			procState.Status = "restarting"
+			procState.PID = 0
+			procState.Fingerprint = nil
+			procState.Restarts++
+			procState.UnstableRestarts = unstableRestarts
+			procState.Backoff = backoff
+			procState.RecordExit(exit)
+		})
 		if err != nil {
-			logrus.Errorf("Failed to restart process %s: %v", proc.Config.Name, err)
+			logrus.Warnf("Failed to save state for process %s: %v", proc.Config.Name, err)
 		}
+
+		pm.restartAfter(proc, backoff.Delay, restartReason)
 	} else {
 		// Process won't be restarted, clean up
-		utils.DeletePIDFile(proc.Config.Name, pm.processesPath)
+		exit.Reason = "exited"
+		if exitReason != "" {
+			exit.Reason = exitReason
+		}
+		if completed {
+			exit.Reason = "completed"
+		}
+		if pm.isCurrent(proc) {
+			pm.recordStopped(proc.Config.Name, exit)
+		}
 
-		pm.mutex.Lock()
-		delete(pm.processes, proc.Config.Name)
-		pm.mutex.Unlock()
+		pm.removeProcess(proc)
 
 		logrus.Infof("Process %s exited and won't be restarted", proc.Config.Name)
 	}
 }
 
+// restartAfter restarts a process that exited once delay has passed. A stop
+// in the meantime cancels the restart.
+func (pm *ProcessManager) restartAfter(proc *ManagedProcess, delay time.Duration, restartReason string) {
+	// Wait before restarting, a stop cuts the wait short
+	proc.mu.Lock()
+	proc.Status = "restarting"
+	proc.mu.Unlock()
+	pm.events.Publish(Event{Type: EventBackoff, Process: proc.Config.Name, Delay: delay})
+	select {
+	case <-time.After(delay):
+	case <-proc.stopCh:
+	}
+
+	// A stop that came in during the delay cancels the restart
+	proc.mu.RLock()
+	stopping := proc.stopping
+	proc.mu.RUnlock()
+	if stopping {
+		if pm.isCurrent(proc) {
+			pm.recordStopped(proc.Config.Name, ExitRecord{})
+		}
+		pm.removeProcess(proc)
+		pm.events.Publish(Event{Type: EventStopped, Process: proc.Config.Name})
+		logrus.Infof("Process %s stopped", proc.Config.Name)
+		return
+	}
+
+	// Increment restart counter
+	proc.mu.Lock()
+	proc.Restarts++
+	proc.mu.Unlock()
+
+	// Restart the process, its dependencies are left as they are
+	pm.events.Publish(Event{Type: EventRestarting, Process: proc.Config.Name, Reason: restartReason})
+	pm.mutex.Lock()
+	if pm.processes[proc.Config.Name] != proc {
+		// Replaced while the restart was pending, the new instance stays
+		pm.mutex.Unlock()
+		return
+	}
+	proc.mu.Lock()
+	proc.Status = "stopped" // Done, so its new instance may start
+	proc.mu.Unlock()
+	err := pm.reserveStart(proc.Config)
+	pm.mutex.Unlock()
+	if err == nil {
+		_, err = pm.spawnProcess(proc.Config)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to restart process %s: %v", proc.Config.Name, err)
+		pm.recordErrored(proc, ExitRecord{})
+		pm.events.Publish(Event{Type: EventGaveUp, Process: proc.Config.Name, Reason: "restart failed", Error: err.Error()})
+		return
+	}
+
+	// The restart is no longer pending
+	err = pm.store.UpdateProcess(proc.Config.Name, func(procState *ProcessState) {
+		if procState.Backoff != nil {
+			procState.Backoff.NextRestart = time.Time{}
+		}
+	})
+	if err != nil {
+		logrus.Warnf("Failed to save state for process %s: %v", proc.Config.Name, err)
+	}
+}
+
+// recordErrored marks a process that gave up restarting as errored. It stays
+// listed until it is started or stopped again.
+func (pm *ProcessManager) recordErrored(proc *ManagedProcess, exit ExitRecord) {
+	proc.mu.Lock()
+	proc.Status = "errored"
+	proc.mu.Unlock()
+
+	err := pm.store.UpdateProcess(proc.Config.Name, func(procState *ProcessState) {
+		procState.Status = "errored"
+		procState.PID = 0
+		procState.Fingerprint = nil
+		procState.UnstableRestarts = 0
+		procState.Backoff = nil
+		if !exit.Time.IsZero() {
+			procState.RecordExit(exit)
+		}
+	})
+	if err != nil {
+		logrus.Warnf("Failed to save state for process %s: %v", proc.Config.Name, err)
+	}
+}
+
+// recordStopped marks a process as no longer running in the state store.
+// Cluster workers only exist as part of their cluster and are forgotten.
+func (pm *ProcessManager) recordStopped(name string, exit ExitRecord) {
+	err := pm.store.Update(func(state *State) error {
+		procState, exists := state.Processes[name]
+		if !exists {
+			return nil
+		}
+		if procState.Cluster != "" {
+			delete(state.Processes, name)
+			return nil
+		}
+
+		// An exit only counts as a failure by the process's own standards
+		procConfig := procState.Config
+		if procConfig == nil {
+			procConfig = &config.ProcessConfig{}
+		}
+		procState.Status = "stopped"
+		if (exit.Reason == "exited" || exit.Reason == oomKillReason) && !cleanExit(procConfig, exit) {
+			procState.Status = "failed"
+		}
+		if exit.Reason == "completed" {
+			procState.Status = "completed"
+		}
+		procState.PID = 0
+		procState.Fingerprint = nil
+		procState.UnstableRestarts = 0
+		procState.Backoff = nil
+		if !exit.Time.IsZero() {
+			procState.RecordExit(exit)
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("Failed to save state for process %s: %v", name, err)
+	}
+}
+
+// exitRecord describes how a process exited from the error returned by wait
+func exitRecord(pid int, err error) ExitRecord {
+	record := ExitRecord{Time: time.Now(), PID: pid}
+	if err == nil {
+		return record
+	}
+
+	record.ExitCode = -1
+	var status syscall.WaitStatus
+	var exitErr *exec.ExitError
+	var reaped *reapedExit
+	switch {
+	case errors.As(err, &reaped):
+		status = reaped.status
+	case errors.As(err, &exitErr):
+		var ok bool
+		if status, ok = exitErr.Sys().(syscall.WaitStatus); !ok {
+			return record
+		}
+	default:
+		return record
+	}
+
+	if status.Signaled() {
+		record.Signal = unix.SignalName(status.Signal())
+	} else {
+		record.ExitCode = status.ExitStatus()
+	}
+	return record
+}
+
+// Snapshot returns a copy of what the API shows of a process and its cluster
+// workers, taken under their locks so it can be encoded safely
+func (proc *ManagedProcess) Snapshot() *ManagedProcess {
+	proc.mu.RLock()
+	snapshot := &ManagedProcess{
+		Config:    proc.Config,
+		PID:       proc.PID,
+		Status:    proc.Status,
+		StartTime: proc.StartTime,
+		Restarts:  proc.Restarts,
+		Adopted:   proc.Adopted,
+	}
+	if proc.Health != nil {
+		health := *proc.Health
+		snapshot.Health = &health
+	}
+	workers := proc.ClusterProcs
+	proc.mu.RUnlock()
+
+	for _, worker := range workers {
+		snapshot.ClusterProcs = append(snapshot.ClusterProcs, worker.Snapshot())
+	}
+	return snapshot
+}
+
+// wait blocks until the process exits
+func (proc *ManagedProcess) wait() error {
+	if proc.Cmd != nil {
+		return waitCommand(proc.Cmd)
+	}
+	return waitMainProcess(proc.PID)
+}
+
+// signal sends a signal to the process
+func (proc *ManagedProcess) signal(sig syscall.Signal) error {
+	proc.mu.RLock()
+	cmd, pid, fingerprint := proc.Cmd, proc.PID, proc.fingerprint
+	proc.mu.RUnlock()
+
+	if cmd != nil {
+		return cmd.Process.Signal(sig)
+	}
+
+	// Adopted processes are signalled by PID, as long as it is still theirs
+	if pid <= 0 || !utils.IsProcessRunning(int32(pid), fingerprint) {
+		return fmt.Errorf("process %s is not running", proc.Config.Name)
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// publishHookFailed publishes the failure of a lifecycle script
+func (pm *ProcessManager) publishHookFailed(name, hook string, err error) {
+	pm.events.Publish(Event{Type: EventHookFailed, Process: name, Hook: hook, Error: err.Error()})
+}
+
+// isCurrent reports whether proc is still the instance of its process in the
+// map, so its exit may be recorded
+func (pm *ProcessManager) isCurrent(proc *ManagedProcess) bool {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	return pm.processes[proc.Config.Name] == proc
+}
+
+// IsTerminalStatus reports whether a process in status is done, so a new
+// instance of it may be started
+func IsTerminalStatus(status string) bool {
+	switch status {
+	case "stopped", "errored", "completed", "failed":
+		return true
+	}
+	return false
+}
+
+// removeProcess removes a process from the map unless it has already been replaced
+func (pm *ProcessManager) removeProcess(proc *ManagedProcess) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if current, exists := pm.processes[proc.Config.Name]; exists && current == proc {
+		delete(pm.processes, proc.Config.Name)
+		if proc.cgroup != "" {
+			removeCgroup(proc.cgroup)
+		}
+	}
+}
+
 // Helper functions
 
 // setupLogging sets up logging for a process
@@ -596,132 +1463,66 @@ func closeLogFiles(logFiles map[string]*os.File) {
 	}
 }
 
+// processEnvironment returns the environment of a process, the daemon's own
+// with the variables of the process on top
+func processEnvironment(procConfig *config.ProcessConfig) []string {
+	env := os.Environ()
+	for k, v := range procConfig.Environment {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	return env
+}
+
 // setProcessUser sets the user and group for a process
 func setProcessUser(cmd *exec.Cmd, username, groupname string) error {
+	credential, err := lookupCredential(username, groupname)
+	if err != nil {
+		return err
+	}
+
+	// Set up credentials
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	return nil
+}
+
+// lookupCredential resolves the user, and the group if one is given, a
+// process runs as
+func lookupCredential(username, groupname string) (*syscall.Credential, error) {
 	// Get user info
 	u, err := user.Lookup(username)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Parse user ID
 	uid, err := strconv.Atoi(u.Uid)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// Set up credentials
-	cmd.SysProcAttr = &syscall.SysProcAttr{}
-	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid)}
+	credential := &syscall.Credential{Uid: uint32(uid)}
 
 	// Set group if specified
 	if groupname != "" {
 		g, err := user.LookupGroup(groupname)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		gid, err := strconv.Atoi(g.Gid)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		cmd.SysProcAttr.Credential.Gid = uint32(gid)
-	}
-
-	return nil
-}
-
-// saveConfigFile saves a process configuration to a file
-func saveConfigFile(procConfig *config.ProcessConfig, filePath string) error {
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-
-	// Marshal config to YAML
-	data, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer data.Close()
-
-	// Use viper to write the config
-	v := viper.New()
-	v.SetConfigType("yaml")
-
-	// Set values
-	v.Set("name", procConfig.Name)
-	v.Set("cmd", procConfig.Command)
-
-	if len(procConfig.Args) > 0 {
-		v.Set("args", procConfig.Args)
-	}
-	if procConfig.WorkingDir != "" {
-		v.Set("cwd", procConfig.WorkingDir)
-	}
-	if len(procConfig.Environment) > 0 {
-		v.Set("env", procConfig.Environment)
-	}
-	if procConfig.Restart != "" {
-		v.Set("restart", procConfig.Restart)
-	}
-	if procConfig.MaxRestarts > 0 {
-		v.Set("max_restarts", procConfig.MaxRestarts)
-	}
-	if procConfig.RestartDelay > 0 {
-		v.Set("restart_delay", procConfig.RestartDelay)
-	}
-	if procConfig.Cluster.Instances > 0 {
-		v.Set("cluster.instances", procConfig.Cluster.Instances)
-		v.Set("cluster.mode", procConfig.Cluster.Mode)
-	}
-	if procConfig.Log.Stdout != "" || procConfig.Log.Stderr != "" || procConfig.Log.Rotate {
-		if procConfig.Log.Stdout != "" {
-			v.Set("log.stdout", procConfig.Log.Stdout)
-		}
-		if procConfig.Log.Stderr != "" {
-			v.Set("log.stderr", procConfig.Log.Stderr)
-		}
-		if procConfig.Log.Rotate {
-			v.Set("log.rotate", procConfig.Log.Rotate)
-			v.Set("log.max_size", procConfig.Log.MaxSize)
-			v.Set("log.max_files", procConfig.Log.MaxFiles)
-		}
-	}
-	if procConfig.AutoStart {
-		v.Set("autostart", procConfig.AutoStart)
-	}
-	if procConfig.User != "" {
-		v.Set("user", procConfig.User)
-	}
-	if procConfig.Group != "" {
-		v.Set("group", procConfig.Group)
-	}
-	if procConfig.Scripts.PreStart != "" || procConfig.Scripts.PostStart != "" ||
-		procConfig.Scripts.PreStop != "" || procConfig.Scripts.PostStop != "" {
-		if procConfig.Scripts.PreStart != "" {
-			v.Set("scripts.pre_start", procConfig.Scripts.PreStart)
-		}
-		if procConfig.Scripts.PostStart != "" {
-			v.Set("scripts.post_start", procConfig.Scripts.PostStart)
-		}
-		if procConfig.Scripts.PreStop != "" {
-			v.Set("scripts.pre_stop", procConfig.Scripts.PreStop)
-		}
-		if procConfig.Scripts.PostStop != "" {
-			v.Set("scripts.post_stop", procConfig.Scripts.PostStop)
-		}
+		credential.Gid = uint32(gid)
 	}
 
-	return v.WriteConfig()
+	return credential, nil
 }
 
 // runScript runs a script
 func runScript(script string) error {
 	cmd := exec.Command("sh", "-c", script)
-	return cmd.Run()
+	return runCommand(cmd)
 }
 
 // readLastLines reads the last n lines from a file
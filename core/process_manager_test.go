@@ -1,12 +1,17 @@
 package core
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+	"github.com/shirou/gopsutil/v3/process"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,13 +21,14 @@ func TestNewProcessManager(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
-	processesPath := filepath.Join(tempDir, "processes")
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
 	logsPath := filepath.Join(tempDir, "logs")
 
 	// Create process manager
-	pm := NewProcessManager(processesPath, logsPath)
+	pm := NewProcessManager(store, logsPath)
 	assert.NotNil(t, pm)
-	assert.Equal(t, processesPath, pm.processesPath)
+	assert.Equal(t, store, pm.store)
 	assert.Equal(t, logsPath, pm.logsPath)
 	assert.Empty(t, pm.processes)
 }
@@ -33,11 +39,12 @@ func TestStartStopProcess(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
-	processesPath := filepath.Join(tempDir, "processes")
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
 	logsPath := filepath.Join(tempDir, "logs")
 
 	// Create process manager
-	pm := NewProcessManager(processesPath, logsPath)
+	pm := NewProcessManager(store, logsPath)
 
 	// Create process config
 	procConfig := &config.ProcessConfig{
@@ -79,11 +86,12 @@ func TestListProcesses(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
-	processesPath := filepath.Join(tempDir, "processes")
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
 	logsPath := filepath.Join(tempDir, "logs")
 
 	// Create process manager
-	pm := NewProcessManager(processesPath, logsPath)
+	pm := NewProcessManager(store, logsPath)
 
 	// No processes initially
 	processes := pm.ListProcesses()
@@ -115,11 +123,12 @@ func TestClusterProcess(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
-	processesPath := filepath.Join(tempDir, "processes")
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
 	logsPath := filepath.Join(tempDir, "logs")
 
 	// Create process manager
-	pm := NewProcessManager(processesPath, logsPath)
+	pm := NewProcessManager(store, logsPath)
 
 	// Create process config with cluster
 	procConfig := &config.ProcessConfig{
@@ -144,6 +153,14 @@ func TestClusterProcess(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 2, info.Instances)
 
+	// A snapshot copies the master and its workers
+	snapshot := proc.Snapshot()
+	assert.NotSame(t, proc, snapshot)
+	assert.Equal(t, "running", snapshot.Status)
+	assert.Len(t, snapshot.ClusterProcs, 2)
+	assert.NotSame(t, proc.ClusterProcs[0], snapshot.ClusterProcs[0])
+	assert.Equal(t, proc.ClusterProcs[0].PID, snapshot.ClusterProcs[0].PID)
+
 	// Stop cluster
 	err = pm.StopProcess("test-cluster", true)
 	assert.NoError(t, err)
@@ -155,3 +172,977 @@ func TestClusterProcess(t *testing.T) {
 	_, err = pm.GetProcess("test-cluster")
 	assert.Error(t, err)
 }
+
+func TestStopProcessDoesNotRestart(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+
+	// Start a process that would always be restarted
+	procConfig := &config.ProcessConfig{
+		Name:         "test-process",
+		Command:      "sleep",
+		Args:         []string{"10"},
+		Restart:      "always",
+		RestartDelay: 0,
+	}
+
+	_, err = pm.StartProcess(procConfig)
+	assert.NoError(t, err)
+
+	// Stop process
+	err = pm.StopProcess("test-process", false)
+	assert.NoError(t, err)
+
+	// Wait for process to stop
+	time.Sleep(1 * time.Second)
+
+	// Check that the process was not restarted
+	_, err = pm.GetProcess("test-process")
+	assert.Error(t, err)
+}
+
+func TestStopDuringRestart(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+
+	// The process takes a while to exit, so the restart is still stopping it
+	// when the user steps in
+	procConfig := &config.ProcessConfig{
+		Name:    "slow-exit",
+		Command: "sh",
+		Args:    []string{"-c", "trap 'sleep 0.5; exit 0' TERM; sleep 30 & wait"},
+	}
+	restartStopped := func(step func(proc *ManagedProcess)) {
+		proc, err := pm.StartProcess(procConfig)
+		assert.NoError(t, err)
+		time.Sleep(200 * time.Millisecond)
+
+		restarted := make(chan struct{})
+		go func() {
+			defer close(restarted)
+			pm.restartWithReason(proc, "test", func(procState *ProcessState) {})
+		}()
+		for event := range sub.Events() {
+			if event.Type == EventRestarting {
+				break
+			}
+		}
+		step(proc)
+		<-restarted
+	}
+
+	// A stop keeps it stopped
+	restartStopped(func(proc *ManagedProcess) {
+		assert.NoError(t, pm.StopProcess("slow-exit", false))
+	})
+	_, err = pm.GetProcess("slow-exit")
+	assert.Error(t, err)
+
+	// A restart leaves only its own instance running
+	var replacement *ManagedProcess
+	restartStopped(func(proc *ManagedProcess) {
+		assert.NoError(t, pm.RestartProcess("slow-exit"))
+		replacement, err = pm.GetProcess("slow-exit")
+		assert.NoError(t, err)
+	})
+	proc, err := pm.GetProcess("slow-exit")
+	assert.NoError(t, err)
+	assert.Same(t, replacement, proc)
+	assert.Equal(t, "running", proc.Status)
+
+	assert.NoError(t, pm.StopProcess("slow-exit", false))
+}
+
+func TestStopProcessKillTimeout(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+
+	// A process that ignores SIGTERM is killed once kill_timeout is up
+	proc, err := pm.StartProcess(&config.ProcessConfig{
+		Name:        "stubborn",
+		Command:     "sh",
+		Args:        []string{"-c", "trap '' TERM; exec sleep 30"},
+		Restart:     "always",
+		KillTimeout: 1,
+	})
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- pm.StopProcess("stubborn", false)
+	}()
+
+	// No second instance starts while it is stopping
+	assert.Eventually(t, func() bool {
+		info, err := pm.GetProcessInfo("stubborn")
+		return err == nil && info.Status == "stopping"
+	}, time.Second, 10*time.Millisecond)
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "stubborn", Command: "sleep", Args: []string{"30"}})
+	assert.EqualError(t, err, "process stubborn is already stopping")
+
+	assert.NoError(t, <-stopped)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// Stop only returns once the process is gone
+	assert.False(t, processExists(proc.PID))
+	_, err = pm.GetProcess("stubborn")
+	assert.Error(t, err)
+	procState, ok := store.Get("stubborn")
+	assert.True(t, ok)
+	assert.Equal(t, "stopped", procState.Status)
+
+	// A stop during the restart delay cancels the restart
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "crashing", Command: "false", Restart: "always", RestartDelay: 1})
+	assert.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+
+	assert.NoError(t, pm.StopProcess("crashing", false))
+	_, err = pm.GetProcess("crashing")
+	assert.Error(t, err)
+	procState, ok = store.Get("crashing")
+	assert.True(t, ok)
+	assert.Equal(t, "stopped", procState.Status)
+}
+
+func TestStopSignalsProcessGroup(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+
+	// A shell wrapper leads its own group along with its children
+	proc, err := pm.StartProcess(&config.ProcessConfig{
+		Name:    "wrapper",
+		Command: "sh",
+		Args:    []string{"-c", "sleep 30 & sleep 30 & wait"},
+		Restart: "no",
+	})
+	assert.NoError(t, err)
+	assert.True(t, isGroupLeader(proc.PID))
+
+	var children []int32
+	assert.Eventually(t, func() bool {
+		children, _ = pm.Descendants("wrapper")
+		return len(children) == 2
+	}, 2*time.Second, 50*time.Millisecond)
+
+	// The stop signal reaches the children too
+	assert.NoError(t, pm.StopProcess("wrapper", false))
+	for _, pid := range children {
+		assert.Eventually(t, func() bool { return hasExited(pid) }, time.Second, 50*time.Millisecond)
+	}
+
+	// A custom stop signal is used instead of SIGTERM
+	marker := filepath.Join(tempDir, "stopped")
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:       "custom",
+		Command:    "sh",
+		Args:       []string{"-c", "trap 'touch " + marker + "; exit 0' USR1; while true; do sleep 0.1; done"},
+		Restart:    "no",
+		StopSignal: "USR1",
+	})
+	assert.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+
+	assert.NoError(t, pm.StopProcess("custom", false))
+	assert.FileExists(t, marker)
+
+	// Invalid stop signals are rejected up front
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "invalid", Command: "sleep", Args: []string{"10"}, StopSignal: "SIGNOPE"})
+	assert.Error(t, err)
+
+	// Processes can opt out of their own group
+	proc, err = pm.StartProcess(&config.ProcessConfig{Name: "grouped", Command: "sleep", Args: []string{"10"}, NoProcessGroup: true})
+	assert.NoError(t, err)
+	assert.False(t, isGroupLeader(proc.PID))
+	assert.NoError(t, pm.StopProcess("grouped", true))
+}
+
+func TestSignalAndReloadProcess(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+
+	// Every process records the signals it gets under its own name
+	script := "trap 'touch " + tempDir + "/$GEM_PROCESS.hup' HUP; " +
+		"trap 'touch " + tempDir + "/$GEM_PROCESS.usr1' USR1; " +
+		"trap 'touch " + tempDir + "/$GEM_PROCESS.usr2' USR2; " +
+		"while true; do sleep 0.1; done"
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:    "cluster",
+		Command: "sh",
+		Args:    []string{"-c", script},
+		Cluster: config.ClusterConfig{Instances: 2},
+	})
+	assert.NoError(t, err)
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:         "custom",
+		Command:      "sh",
+		Args:         []string{"-c", script},
+		ReloadSignal: "USR2",
+	})
+	assert.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+
+	// Signals and reloads of a cluster reach every worker
+	assert.NoError(t, pm.SignalProcess("cluster", syscall.SIGUSR1))
+	assert.NoError(t, pm.ReloadProcess("cluster"))
+	assert.NoError(t, pm.ReloadProcess("custom"))
+
+	for _, file := range []string{"cluster-worker-0.usr1", "cluster-worker-1.usr1", "cluster-worker-0.hup", "cluster-worker-1.hup", "custom.usr2"} {
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(filepath.Join(tempDir, file))
+			return err == nil
+		}, 2*time.Second, 50*time.Millisecond, file)
+	}
+	assert.NoFileExists(t, filepath.Join(tempDir, "custom.hup"))
+
+	// Unknown processes and reload signals are reported
+	assert.Error(t, pm.ReloadProcess("missing"))
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "invalid", Command: "sleep", Args: []string{"10"}, ReloadSignal: "SIGNOPE"})
+	assert.Error(t, err)
+
+	// Clean up
+	assert.NoError(t, pm.StopProcess("cluster", true))
+	assert.NoError(t, pm.StopProcess("custom", true))
+}
+
+func TestRestartBackoff(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+
+	// A crashing process waits out its backoff before the restart
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:           "crashing",
+		Command:        "false",
+		Restart:        "on-failure",
+		RestartBackoff: config.BackoffConfig{InitialDelay: 5, Multiplier: 2},
+	})
+	assert.NoError(t, err)
+
+	var delay time.Duration
+	for event := range sub.Events() {
+		if event.Type == EventBackoff {
+			delay = event.Delay
+			break
+		}
+	}
+	assert.Equal(t, 5*time.Second, delay)
+
+	// The pending restart shows in the process info
+	info, err := pm.GetProcessInfo("crashing")
+	assert.NoError(t, err)
+	assert.Equal(t, "restarting", info.Status)
+	if assert.NotNil(t, info.Backoff) {
+		assert.Equal(t, 1, info.Backoff.Attempt)
+		assert.Equal(t, 5*time.Second, info.Backoff.Delay)
+		assert.WithinDuration(t, time.Now().Add(5*time.Second), info.Backoff.NextRestart, time.Second)
+	}
+
+	// A start can't race the pending restart
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "crashing", Command: "sleep", Args: []string{"30"}})
+	assert.EqualError(t, err, "process crashing is already restarting")
+
+	// A stop doesn't wait for the delay to run out
+	start := time.Now()
+	assert.NoError(t, pm.StopProcess("crashing", false))
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	procState, ok := store.Get("crashing")
+	assert.True(t, ok)
+	assert.Equal(t, "stopped", procState.Status)
+	assert.Nil(t, procState.Backoff)
+}
+
+func TestSuccessExitCodes(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+
+	// A batch worker that exits 75 on purpose is done, not failed
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:             "batch",
+		Command:          "sh",
+		Args:             []string{"-c", "exit 75"},
+		Restart:          "on-failure",
+		SuccessExitCodes: []int{75},
+	})
+	assert.NoError(t, err)
+
+	// One that crashes keeps failing
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:               "misconfigured",
+		Command:            "sh",
+		Args:               []string{"-c", "exit 78"},
+		Restart:            "always",
+		NoRestartExitCodes: []int{78},
+	})
+	assert.NoError(t, err)
+
+	for name, status := range map[string]string{"batch": "completed", "misconfigured": "failed"} {
+		assert.Eventually(t, func() bool {
+			_, err := pm.GetProcess(name)
+			return err != nil
+		}, 2*time.Second, 50*time.Millisecond)
+
+		procState, ok := store.Get(name)
+		assert.True(t, ok)
+		assert.Equal(t, status, procState.Status)
+		assert.Equal(t, 0, procState.Restarts)
+	}
+}
+
+func TestCrashLoopErrored(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+
+	// A process that crashes right away spends its budget and gives up
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:        "crashing",
+		Command:     "false",
+		Restart:     "always",
+		MaxRestarts: 2,
+		MinUptime:   5,
+	})
+	assert.NoError(t, err)
+
+	var gaveUp Event
+	for event := range sub.Events() {
+		if event.Type == EventGaveUp {
+			gaveUp = event
+			break
+		}
+	}
+	assert.Equal(t, "max restarts reached", gaveUp.Reason)
+
+	// It stays listed as errored, with the restarts it went through
+	proc, err := pm.GetProcess("crashing")
+	assert.NoError(t, err)
+	info, err := pm.GetProcessInfo("crashing")
+	assert.NoError(t, err)
+	assert.Equal(t, "errored", info.Status)
+	assert.Equal(t, 2, info.Restarts)
+	assert.Contains(t, pm.ListProcesses(), proc)
+
+	procState, ok := store.Get("crashing")
+	assert.True(t, ok)
+	assert.Equal(t, "errored", procState.Status)
+	assert.Equal(t, 2, procState.Restarts)
+
+	// It is still listed after the daemon restarts
+	restarted := NewProcessManager(store, logsPath)
+	assert.NoError(t, restarted.LoadRunningProcesses())
+	info, err = restarted.GetProcessInfo("crashing")
+	assert.NoError(t, err)
+	assert.Equal(t, "errored", info.Status)
+	assert.Equal(t, 2, info.Restarts)
+
+	// Stopping clears it
+	assert.NoError(t, restarted.StopProcess("crashing", false))
+	_, err = restarted.GetProcess("crashing")
+	assert.Error(t, err)
+	assert.NoError(t, pm.StopProcess("crashing", false))
+	_, err = pm.GetProcess("crashing")
+	assert.Error(t, err)
+	procState, _ = store.Get("crashing")
+	assert.Equal(t, "stopped", procState.Status)
+
+	// Exits after min_uptime don't count toward the budget
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:        "flaky",
+		Command:     "sh",
+		Args:        []string{"-c", "sleep 1.2; exit 1"},
+		Restart:     "always",
+		MaxRestarts: 1,
+		MinUptime:   1,
+	})
+	assert.NoError(t, err)
+	time.Sleep(3 * time.Second)
+
+	info, err = pm.GetProcessInfo("flaky")
+	assert.NoError(t, err)
+	assert.Equal(t, "running", info.Status)
+	assert.GreaterOrEqual(t, info.Restarts, 1)
+	assert.NoError(t, pm.StopProcess("flaky", false))
+}
+
+// hasExited reports whether a process is gone or only left a zombie behind
+func hasExited(pid int32) bool {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return true
+	}
+	status, err := p.Status()
+	return err != nil || (len(status) > 0 && status[0] == process.Zombie)
+}
+
+// startOrphan starts a process outside the process manager and records it the
+// way a previous daemon would have
+func startOrphan(t *testing.T, store *StateStore, procConfig *config.ProcessConfig) int {
+	cmd := exec.Command("sleep", "10")
+	assert.NoError(t, cmd.Start())
+	go cmd.Wait()
+
+	fingerprint, err := utils.GetProcessFingerprint(int32(cmd.Process.Pid))
+	assert.NoError(t, err)
+	err = store.UpdateProcess(procConfig.Name, func(procState *ProcessState) {
+		procState.Config = procConfig
+		procState.Status = "running"
+		procState.PID = cmd.Process.Pid
+		procState.Fingerprint = fingerprint
+	})
+	assert.NoError(t, err)
+
+	return cmd.Process.Pid
+}
+
+func TestAdoptRunningProcess(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Start a process the new manager didn't spawn
+	pid := startOrphan(t, store, &config.ProcessConfig{
+		Name:    "test-process",
+		Command: "sleep",
+		Args:    []string{"10"},
+		Restart: "no",
+	})
+	time.Sleep(1100 * time.Millisecond)
+
+	// Adopt it
+	pm := NewProcessManager(store, logsPath)
+	assert.NoError(t, pm.LoadRunningProcesses())
+
+	proc, err := pm.GetProcess("test-process")
+	assert.NoError(t, err)
+	assert.True(t, proc.Adopted)
+	assert.Equal(t, pid, proc.PID)
+	assert.True(t, proc.StartTime.Before(time.Now().Add(-time.Second)))
+
+	// Adopted processes can be signalled and stopped
+	assert.NoError(t, pm.SignalProcess("test-process", syscall.SIGCONT))
+	assert.NoError(t, pm.StopProcess("test-process", false))
+
+	assert.Eventually(t, func() bool {
+		_, err := pm.GetProcess("test-process")
+		return err != nil
+	}, 3*time.Second, 50*time.Millisecond)
+	assert.False(t, processExists(pid))
+}
+
+func TestAdoptedProcessRestarts(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Start a process the new manager didn't spawn
+	pid := startOrphan(t, store, &config.ProcessConfig{
+		Name:         "test-process",
+		Command:      "sleep",
+		Args:         []string{"10"},
+		Restart:      "on-failure",
+		RestartDelay: 1,
+	})
+
+	// Adopt it
+	pm := NewProcessManager(store, logsPath)
+	assert.NoError(t, pm.LoadRunningProcesses())
+
+	// Kill it behind Gem's back, the restart policy should apply
+	assert.NoError(t, syscall.Kill(pid, syscall.SIGKILL))
+
+	assert.Eventually(t, func() bool {
+		proc, err := pm.GetProcess("test-process")
+		return err == nil && !proc.Adopted && proc.PID != pid
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Clean up
+	assert.NoError(t, pm.StopProcess("test-process", true))
+}
+
+func TestResumeRestart(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Two processes were waiting to be restarted when the daemon went down
+	for _, name := range []string{"resumed", "cancelled"} {
+		procConfig := &config.ProcessConfig{Name: name, Command: "sleep", Args: []string{"10"}, Restart: "always"}
+		err := store.UpdateProcess(name, func(procState *ProcessState) {
+			procState.Config = procConfig
+			procState.Status = "restarting"
+			procState.Restarts = 3
+			procState.Backoff = &utils.BackoffState{Delay: time.Second, Attempt: 3, NextRestart: time.Now().Add(time.Second)}
+		})
+		assert.NoError(t, err)
+	}
+
+	pm := NewProcessManager(store, logsPath)
+	assert.NoError(t, pm.LoadRunningProcesses())
+	info, err := pm.GetProcessInfo("resumed")
+	assert.NoError(t, err)
+	assert.Equal(t, "restarting", info.Status)
+
+	// A stop cancels the restart
+	assert.NoError(t, pm.StopProcess("cancelled", false))
+	_, err = pm.GetProcess("cancelled")
+	assert.Error(t, err)
+	procState, _ := store.Get("cancelled")
+	assert.Equal(t, "stopped", procState.Status)
+
+	// The other one starts once the rest of its delay has passed
+	assert.Eventually(t, func() bool {
+		procState, _ := store.Get("resumed")
+		return procState.Status == "running" && procState.PID > 0
+	}, 3*time.Second, 50*time.Millisecond)
+	proc, err := pm.GetProcess("resumed")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, proc.Restarts)
+
+	// Clean up
+	assert.NoError(t, pm.StopProcess("resumed", true))
+}
+
+func TestAutoStart(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Store definitions left behind by a previous daemon
+	definitions := []*config.ProcessConfig{
+		{Name: "web", Command: "sleep", Args: []string{"10"}, AutoStart: true},
+		{Name: "broken", Command: "/nonexistent/binary", AutoStart: true},
+		{Name: "manual", Command: "sleep", Args: []string{"10"}},
+	}
+	for _, procConfig := range definitions {
+		procConfig := procConfig
+		err := store.UpdateProcess(procConfig.Name, func(procState *ProcessState) {
+			procState.Config = procConfig
+		})
+		assert.NoError(t, err)
+	}
+
+	// Boot the manager
+	pm := NewProcessManager(store, logsPath)
+	result := pm.AutoStart(2)
+
+	assert.Equal(t, []string{"web"}, result.Started)
+	assert.Len(t, result.Failed, 1)
+	assert.Contains(t, result.Failed, "broken")
+
+	_, err = pm.GetProcess("web")
+	assert.NoError(t, err)
+	_, err = pm.GetProcess("manual")
+	assert.Error(t, err)
+
+	// Running processes are not started twice
+	result = pm.AutoStart(2)
+	assert.Empty(t, result.Started)
+
+	// Slow pre_start scripts run side by side and don't hold up the rest
+	for _, name := range []string{"slow-a", "slow-b"} {
+		procConfig := &config.ProcessConfig{Name: name, Command: "sleep", Args: []string{"10"}, AutoStart: true}
+		procConfig.Scripts.PreStart = "sleep 1"
+		err := store.UpdateProcess(name, func(procState *ProcessState) {
+			procState.Config = procConfig
+		})
+		assert.NoError(t, err)
+	}
+	start := time.Now()
+	done := make(chan *AutoStartResult)
+	go func() { done <- pm.AutoStart(2) }()
+	time.Sleep(200 * time.Millisecond)
+	pm.ListProcesses()
+	_, err = pm.GetProcessInfo("web")
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	result = <-done
+	assert.Equal(t, []string{"slow-a", "slow-b"}, result.Started)
+	assert.Less(t, time.Since(start), 1800*time.Millisecond)
+
+	// Clean up
+	for _, name := range []string{"web", "slow-a", "slow-b"} {
+		assert.NoError(t, pm.StopProcess(name, true))
+	}
+}
+
+func TestStopAll(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+
+	// One process exits on SIGTERM, the other has to be killed
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "polite", Command: "sleep", Args: []string{"10"}, Restart: "always"})
+	assert.NoError(t, err)
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "stubborn", Command: "sh", Args: []string{"-c", "trap '' TERM; sleep 10"}, Restart: "always", KillTimeout: 1})
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	pm.StopAll()
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Everything is gone and nothing was restarted
+	assert.Empty(t, pm.ListProcesses())
+	for _, name := range []string{"polite", "stubborn"} {
+		procState, ok := store.Get(name)
+		assert.True(t, ok)
+		assert.Equal(t, "stopped", procState.Status)
+	}
+
+	// No process may start once the daemon is shutting down
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "late", Command: "sleep", Args: []string{"10"}})
+	assert.Error(t, err)
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+
+	// nextEvents collects events until one of the given type arrives
+	nextEvents := func(last EventType) []Event {
+		var events []Event
+		timeout := time.After(5 * time.Second)
+		for len(events) == 0 || events[len(events)-1].Type != last {
+			select {
+			case event := <-sub.Events():
+				events = append(events, event)
+			case <-timeout:
+				t.Fatalf("no %s event, got %v", last, events)
+			}
+		}
+		return events
+	}
+	eventTypes := func(events []Event) []EventType {
+		var types []EventType
+		for _, event := range events {
+			types = append(types, event.Type)
+		}
+		return types
+	}
+
+	// A process that exits on its own
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "exits", Command: "sh", Args: []string{"-c", "exit 3"}, Restart: "no"})
+	assert.NoError(t, err)
+
+	events := nextEvents(EventExited)
+	assert.Equal(t, []EventType{EventStarting, EventStarted, EventExited}, eventTypes(events))
+	assert.Equal(t, 3, events[2].ExitCode)
+	assert.Equal(t, events[1].PID, events[2].PID)
+
+	// A process stopped on request
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "stopped", Command: "sleep", Args: []string{"10"}, Restart: "always"})
+	assert.NoError(t, err)
+	nextEvents(EventStarted)
+	assert.NoError(t, pm.StopProcess("stopped", false))
+
+	events = nextEvents(EventStopped)
+	assert.Equal(t, []EventType{EventExited, EventStopped}, eventTypes(events))
+	assert.Equal(t, "SIGTERM", events[0].Signal)
+
+	// A failing hook
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "hook", Command: "true", Scripts: config.ScriptsConfig{PreStart: "exit 1"}})
+	assert.Error(t, err)
+
+	events = nextEvents(EventHookFailed)
+	assert.Equal(t, "pre_start", events[len(events)-1].Hook)
+}
+
+func TestStopCleansUpDescendants(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	pm.StartReaper()
+
+	// The subshell exits right away, orphaning its background sleep
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:    "test-process",
+		Command: "sh",
+		Args:    []string{"-c", "(sleep 30 &); sleep 30"},
+		Restart: "no",
+	})
+	assert.NoError(t, err)
+
+	// The orphan is reparented to us and still attributed to the process
+	var descendants []int32
+	assert.Eventually(t, func() bool {
+		descendants, err = pm.Descendants("test-process")
+		return err == nil && len(descendants) == 2
+	}, 2*time.Second, 50*time.Millisecond)
+
+	// Stopping the process takes its descendants with it, and they are reaped
+	proc, err := pm.GetProcess("test-process")
+	assert.NoError(t, err)
+	assert.NoError(t, pm.StopProcess("test-process", false))
+	<-proc.done
+
+	for _, pid := range descendants {
+		assert.Eventually(t, func() bool { return !processExists(int(pid)) }, 2*time.Second, 50*time.Millisecond)
+	}
+}
+
+func TestForkingProcess(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	pm.StartReaper()
+
+	// The command forks a daemon, writes its PID and exits right away
+	pidFile := filepath.Join(tempDir, "daemon.pid")
+	proc, err := pm.StartProcess(&config.ProcessConfig{
+		Name:    "forking",
+		Command: "sh",
+		Args:    []string{"-c", "sleep 30 & echo $! > " + pidFile},
+		Type:    "forking",
+		PIDFile: pidFile,
+		Restart: "always",
+	})
+	assert.NoError(t, err)
+	proc.mu.RLock()
+	parentPID := proc.PID
+	proc.mu.RUnlock()
+
+	// The forked daemon becomes the process
+	var mainPID int
+	assert.Eventually(t, func() bool {
+		procState, _ := store.Get("forking")
+		mainPID = procState.PID
+		return procState.Status == "running" && mainPID != parentPID
+	}, 5*time.Second, 50*time.Millisecond)
+	pid, err := readPIDFile(pidFile)
+	assert.NoError(t, err)
+	assert.Equal(t, pid, mainPID)
+
+	// Without a pid file the only process left behind is the main process
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:    "guessed",
+		Command: "sh",
+		Args:    []string{"-c", "sleep 30 &"},
+		Type:    "forking",
+		Restart: "no",
+	})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		procState, _ := store.Get("guessed")
+		return procState.Status == "running"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Stopping reaches the main process
+	for _, name := range []string{"forking", "guessed"} {
+		proc, err := pm.GetProcess(name)
+		assert.NoError(t, err)
+		assert.NoError(t, pm.StopProcess(name, false))
+		<-proc.done
+	}
+	assert.Eventually(t, func() bool { return !processExists(mainPID) }, 2*time.Second, 50*time.Millisecond)
+	procState, _ := store.Get("forking")
+	assert.Equal(t, "stopped", procState.Status)
+
+	// A pid file may only name a process of the service
+	stranger := exec.Command("sleep", "30")
+	assert.NoError(t, stranger.Start())
+	defer stranger.Process.Kill()
+	for name, pid := range map[string]int{"init": 1, "stranger": stranger.Process.Pid} {
+		pidFile := filepath.Join(tempDir, name+".pid")
+		_, err = pm.StartProcess(&config.ProcessConfig{
+			Name:    name,
+			Command: "sh",
+			Args:    []string{"-c", fmt.Sprintf("echo %d > %s", pid, pidFile)},
+			Type:    "forking",
+			PIDFile: pidFile,
+			Restart: "no",
+		})
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			procState, _ := store.Get(name)
+			return procState.Status == "failed"
+		}, 5*time.Second, 50*time.Millisecond, name)
+	}
+	assert.True(t, processExists(stranger.Process.Pid))
+
+	// The main process is the daemon's child, so its exit status is known
+	for name, exitCode := range map[string]int{"clean": 0, "failing": 3} {
+		pidFile := filepath.Join(tempDir, name+".pid")
+		_, err = pm.StartProcess(&config.ProcessConfig{
+			Name:    name,
+			Command: "sh",
+			Args:    []string{"-c", fmt.Sprintf("(sleep 1; exit %d) & echo $! > %s", exitCode, pidFile)},
+			Type:    "forking",
+			PIDFile: pidFile,
+			Restart: "on-failure",
+		})
+		assert.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		clean, _ := store.Get("clean")
+		failing, _ := store.Get("failing")
+		return len(clean.ExitHistory) > 0 && len(failing.ExitHistory) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	procState, _ = store.Get("clean")
+	assert.Equal(t, "completed", procState.Status)
+	assert.Equal(t, 0, procState.ExitHistory[0].ExitCode)
+	procState, _ = store.Get("failing")
+	assert.Equal(t, 3, procState.ExitHistory[0].ExitCode)
+	assert.NoError(t, pm.StopProcess("failing", false))
+}
+
+func TestOneshotProcess(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+
+	// A oneshot that succeeds completes and is never restarted
+	proc, err := pm.StartProcess(&config.ProcessConfig{Name: "migrate", Command: "true", Type: "oneshot", Restart: "always"})
+	assert.NoError(t, err)
+	<-proc.done
+
+	procState, _ := store.Get("migrate")
+	assert.Equal(t, "completed", procState.Status)
+	_, err = pm.GetProcess("migrate")
+	assert.Error(t, err)
+
+	// Unknown types are refused
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "bad", Command: "true", Type: "notify-later"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,318 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/sirupsen/logrus"
+)
+
+// processEnvMarker is set in the environment of every managed process. Its
+// descendants inherit it, so they can be traced back to the process even once
+// they have been reparented to the daemon.
+const processEnvMarker = "GEM_PROCESS"
+
+// reapInterval is how often orphans are reaped when no SIGCHLD arrives
+const reapInterval = 10 * time.Second
+
+// descendantStopTimeout is how long leftover descendants get to exit after
+// SIGTERM before they are killed
+const descendantStopTimeout = 3 * time.Second
+
+// commands tracks the children started through exec.Cmd, which are reaped by
+// their own Wait. The reaper holds reaping while reaping so that it never
+// takes a child whose command has just been started but not yet recorded.
+var commands = struct {
+	pids    map[int]bool
+	mutex   sync.Mutex
+	reaping sync.RWMutex
+}{pids: make(map[int]bool)}
+
+// mainProcesses tracks the main processes of forking and notify services,
+// which may be children of the daemon without an exec.Cmd. The reaper keeps
+// the exit status of the ones it reaps until their waiter collects it.
+var mainProcesses = struct {
+	tracked map[int]bool
+	exits   map[int]syscall.WaitStatus
+	mutex   sync.Mutex
+}{tracked: make(map[int]bool), exits: make(map[int]syscall.WaitStatus)}
+
+// StartReaper makes the daemon a child subreaper, so orphaned descendants of
+// managed processes are reparented to it rather than to init, and reaps them
+// as they exit
+func (pm *ProcessManager) StartReaper() {
+	if err := enableSubreaper(); err != nil {
+		logrus.Warnf("Failed to become a child subreaper, orphaned descendants won't be tracked: %v", err)
+		return
+	}
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGCHLD)
+		ticker := time.NewTicker(reapInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-signals:
+			case <-ticker.C:
+			}
+			reapOrphans()
+		}
+	}()
+}
+
+// Descendants returns the PIDs of all descendants of a process, including
+// those that outlived their parent and were reparented to the daemon
+func (pm *ProcessManager) Descendants(name string) ([]int32, error) {
+	proc, err := pm.GetProcess(name)
+	if err != nil {
+		return nil, err
+	}
+
+	proc.mu.RLock()
+	pid := int32(proc.PID)
+	proc.mu.RUnlock()
+
+	return findDescendants(pid, name), nil
+}
+
+// startCommand starts cmd and records it as reaped by its own Wait
+func startCommand(cmd *exec.Cmd) error {
+	commands.reaping.RLock()
+	defer commands.reaping.RUnlock()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	recordCommand(cmd.Process.Pid, true)
+	return nil
+}
+
+// startCommandPTY starts cmd on a new pseudoterminal, like startCommand
+func startCommandPTY(cmd *exec.Cmd) (*os.File, error) {
+	commands.reaping.RLock()
+	defer commands.reaping.RUnlock()
+
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+	recordCommand(cmd.Process.Pid, true)
+	return ptmx, nil
+}
+
+// waitCommand waits for a command started with startCommand
+func waitCommand(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	recordCommand(cmd.Process.Pid, false)
+	return err
+}
+
+// runCommand starts cmd and waits for it to finish
+func runCommand(cmd *exec.Cmd) error {
+	if err := startCommand(cmd); err != nil {
+		return err
+	}
+	return waitCommand(cmd)
+}
+
+// findDescendants returns the descendants of root, and of the daemon's
+// children that carry the environment marker of name. root may be 0 once the
+// process itself has exited.
+func findDescendants(root int32, name string) []int32 {
+	pids, err := process.Pids()
+	if err != nil {
+		return nil
+	}
+
+	children := make(map[int32][]int32)
+	for _, pid := range pids {
+		p, err := process.NewProcess(pid)
+		if err != nil {
+			continue
+		}
+		ppid, err := p.Ppid()
+		if err != nil {
+			continue
+		}
+		children[ppid] = append(children[ppid], pid)
+	}
+
+	// Orphans of the process were reparented to the daemon
+	var queue []int32
+	if root > 0 {
+		queue = append(queue, children[root]...)
+	}
+	marker := processEnvMarker + "=" + name
+	for _, pid := range children[int32(os.Getpid())] {
+		if pid != root && !isCommand(int(pid)) && hasEnv(pid, marker) {
+			queue = append(queue, pid)
+		}
+	}
+
+	// Collect everything below them
+	seen := make(map[int32]bool)
+	var descendants []int32
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		if seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		descendants = append(descendants, pid)
+		queue = append(queue, children[pid]...)
+	}
+
+	sort.Slice(descendants, func(i, j int) bool { return descendants[i] < descendants[j] })
+	return descendants
+}
+
+// killDescendants stops whatever a process left behind once it has exited.
+// Leftovers get SIGTERM and are killed if they don't exit in time.
+func killDescendants(name string) {
+	leftovers := findDescendants(0, name)
+	if len(leftovers) == 0 {
+		return
+	}
+
+	logrus.Infof("Stopping %d leftover descendants of process %s", len(leftovers), name)
+	for _, pid := range leftovers {
+		syscall.Kill(int(pid), syscall.SIGTERM)
+	}
+
+	deadline := time.Now().Add(descendantStopTimeout)
+	for time.Now().Before(deadline) {
+		leftovers = findDescendants(0, name)
+		if len(leftovers) == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, pid := range leftovers {
+		logrus.Warnf("Descendant %d of process %s did not exit, killing it", pid, name)
+		syscall.Kill(int(pid), syscall.SIGKILL)
+	}
+}
+
+// trackMainProcess has the reaper keep the exit status of pid
+func trackMainProcess(pid int) {
+	mainProcesses.mutex.Lock()
+	defer mainProcesses.mutex.Unlock()
+
+	mainProcesses.tracked[pid] = true
+}
+
+// untrackMainProcess stops tracking pid
+func untrackMainProcess(pid int) {
+	mainProcesses.mutex.Lock()
+	defer mainProcesses.mutex.Unlock()
+
+	delete(mainProcesses.tracked, pid)
+	delete(mainProcesses.exits, pid)
+}
+
+// recordExit keeps the exit status of a reaped orphan that is tracked
+func recordExit(pid int, status syscall.WaitStatus) {
+	mainProcesses.mutex.Lock()
+	defer mainProcesses.mutex.Unlock()
+
+	if mainProcesses.tracked[pid] {
+		mainProcesses.exits[pid] = status
+	}
+}
+
+// collectExit returns the exit status of a tracked process that has exited,
+// as kept by the reaper or by reaping it right away. It is unknown when the
+// process isn't the daemon's child or was reaped before it was tracked.
+func collectExit(pid int) (syscall.WaitStatus, bool) {
+	commands.reaping.Lock()
+	defer commands.reaping.Unlock()
+
+	mainProcesses.mutex.Lock()
+	status, ok := mainProcesses.exits[pid]
+	mainProcesses.mutex.Unlock()
+	if ok {
+		return status, true
+	}
+
+	if isCommand(pid) {
+		return 0, false
+	}
+	reaped, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+	return status, err == nil && reaped == pid
+}
+
+// recordCommand records whether pid belongs to a running exec.Cmd
+func recordCommand(pid int, running bool) {
+	commands.mutex.Lock()
+	defer commands.mutex.Unlock()
+
+	if running {
+		commands.pids[pid] = true
+	} else {
+		delete(commands.pids, pid)
+	}
+}
+
+// isCommand reports whether pid was started as an exec.Cmd
+func isCommand(pid int) bool {
+	commands.mutex.Lock()
+	defer commands.mutex.Unlock()
+
+	return commands.pids[pid]
+}
+
+// hasEnv reports whether the environment of pid contains entry
+func hasEnv(pid int32, entry string) bool {
+	environ, err := processEnviron(pid)
+	return err == nil && containsEnv(environ, entry)
+}
+
+// processEnviron returns the environment of a process
+func processEnviron(pid int32) ([]string, error) {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	return p.Environ()
+}
+
+// containsEnv reports whether environ has entry, a KEY=value pair
+func containsEnv(environ []string, entry string) bool {
+	for _, env := range environ {
+		if strings.TrimRight(env, "\x00") == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// descendsFrom reports whether pid is a descendant of ancestor
+func descendsFrom(pid, ancestor int32) bool {
+	for pid > 1 {
+		p, err := process.NewProcess(pid)
+		if err != nil {
+			return false
+		}
+		ppid, err := p.Ppid()
+		if err != nil {
+			return false
+		}
+		if ppid == ancestor {
+			return true
+		}
+		pid = ppid
+	}
+	return false
+}
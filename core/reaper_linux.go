@@ -0,0 +1,51 @@
+package core
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// enableSubreaper marks the daemon as a child subreaper
+func enableSubreaper() error {
+	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
+
+// reapOrphans reaps the exited children of the daemon that no exec.Cmd waits
+// for, which are the orphans reparented to it
+func reapOrphans() {
+	commands.reaping.Lock()
+	defer commands.reaping.Unlock()
+
+	pids, err := process.Pids()
+	if err != nil {
+		return
+	}
+
+	self := int32(os.Getpid())
+	for _, pid := range pids {
+		if isCommand(int(pid)) {
+			continue
+		}
+
+		p, err := process.NewProcess(pid)
+		if err != nil {
+			continue
+		}
+		if ppid, err := p.Ppid(); err != nil || ppid != self {
+			continue
+		}
+		if status, err := p.Status(); err != nil || len(status) == 0 || status[0] != process.Zombie {
+			continue
+		}
+
+		var ws unix.WaitStatus
+		if reaped, err := unix.Wait4(int(pid), &ws, unix.WNOHANG, nil); err == nil && reaped == int(pid) {
+			logrus.Debugf("Reaped orphaned process %d (exit status %d)", pid, ws.ExitStatus())
+			recordExit(int(pid), syscall.WaitStatus(ws))
+		}
+	}
+}
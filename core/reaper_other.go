@@ -0,0 +1,13 @@
+//go:build !linux
+
+package core
+
+import "errors"
+
+// enableSubreaper is only supported on Linux
+func enableSubreaper() error {
+	return errors.New("child subreapers are only supported on Linux")
+}
+
+// reapOrphans has nothing to do without a subreaper
+func reapOrphans() {}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// ReloadResult reports what a config reload changed
+type ReloadResult struct {
+	Settings        []string          `json:"settings,omitempty"`         // Global settings applied live
+	RestartRequired []string          `json:"restart_required,omitempty"` // Global settings that need a daemon restart
+	Unchanged       []string          `json:"unchanged,omitempty"`
+	Restarted       []string          `json:"restarted,omitempty"` // Running with a changed definition
+	Updated         []string          `json:"updated,omitempty"`   // Not running, only the definition changed
+	Started         []string          `json:"started,omitempty"`   // Newly added
+	Removed         []string          `json:"removed,omitempty"`   // Definition file removed from processes_path
+	Failed          map[string]string `json:"failed,omitempty"`
+}
+
+// ReloadConfig re-reads config.yaml and the definition of every process that
+// was loaded from a .gem file, plus any new .gem files in processes_path.
+// Running processes whose definition changed are restarted with the new one
+// and new processes are started.
+func (pm *ProcessManager) ReloadConfig() (*ReloadResult, error) {
+	pm.reloadMutex.Lock()
+	defer pm.reloadMutex.Unlock()
+
+	result := &ReloadResult{Failed: make(map[string]string)}
+
+	// Global settings first, the log level applies right away
+	changed, err := config.ReloadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload config.yaml: %v", err)
+	}
+	globalConfig := config.Current()
+	utils.SetLogLevel(globalConfig.LogLevel)
+	for _, key := range changed {
+		if config.RequiresRestart(key) {
+			result.RestartRequired = append(result.RestartRequired, key)
+		} else {
+			result.Settings = append(result.Settings, key)
+		}
+	}
+
+	processesPath := globalConfig.ProcessesPath
+
+	// Re-read the definitions loaded from files
+	known := make(map[string]bool)
+	for name, procState := range pm.store.List() {
+		if procState.Cluster != "" || procState.Config == nil {
+			continue
+		}
+
+		file := procState.Config.ConfigFile
+		if file == "" {
+			result.Unchanged = append(result.Unchanged, name)
+			continue
+		}
+		known[file] = true
+
+		procConfig, err := config.LoadProcessConfig(file)
+		if errors.Is(err, fs.ErrNotExist) && filepath.Dir(file) == processesPath {
+			pm.removeDefinition(name)
+			result.Removed = append(result.Removed, name)
+			continue
+		}
+		if err != nil {
+			result.Failed[name] = err.Error()
+			continue
+		}
+		if procConfig.Name != name {
+			result.Failed[name] = fmt.Sprintf("%s now defines process %s", file, procConfig.Name)
+			continue
+		}
+
+		if sameDefinition(procState.Config, procConfig, pm.logsPath) {
+			result.Unchanged = append(result.Unchanged, name)
+			continue
+		}
+
+		restarted, err := pm.applyDefinition(procConfig)
+		switch {
+		case err != nil:
+			result.Failed[name] = err.Error()
+		case restarted:
+			result.Restarted = append(result.Restarted, name)
+		default:
+			result.Updated = append(result.Updated, name)
+		}
+	}
+
+	// Start the processes added to processes_path, dependencies first
+	var added []*config.ProcessConfig
+	files, _ := filepath.Glob(filepath.Join(processesPath, "*.gem"))
+	for _, file := range files {
+		if known[file] {
+			continue
+		}
+
+		procConfig, err := config.LoadProcessConfig(file)
+		if err != nil {
+			result.Failed[filepath.Base(file)] = err.Error()
+			continue
+		}
+		if _, exists := pm.store.Get(procConfig.Name); exists {
+			result.Failed[procConfig.Name] = fmt.Sprintf("%s defines process %s, which already exists", file, procConfig.Name)
+			continue
+		}
+		added = append(added, procConfig)
+	}
+	for _, procConfig := range SortByDependencies(added) {
+		if _, err := pm.StartProcess(procConfig); err != nil {
+			result.Failed[procConfig.Name] = err.Error()
+			continue
+		}
+		result.Started = append(result.Started, procConfig.Name)
+	}
+
+	sortReloadResult(result)
+	return result, nil
+}
+
+// LogSummary logs the outcome of a config reload
+func (result *ReloadResult) LogSummary() {
+	if len(result.Settings) > 0 {
+		logrus.Infof("Reload applied settings: %s", strings.Join(result.Settings, ", "))
+	}
+	if len(result.RestartRequired) > 0 {
+		logrus.Warnf("Reload needs a daemon restart to apply: %s", strings.Join(result.RestartRequired, ", "))
+	}
+	logrus.Infof("Reload done: %d restarted, %d updated, %d started, %d removed, %d unchanged, %d failed",
+		len(result.Restarted), len(result.Updated), len(result.Started), len(result.Removed), len(result.Unchanged), len(result.Failed))
+	for name, err := range result.Failed {
+		logrus.Errorf("Failed to reload process %s: %v", name, err)
+	}
+}
+
+// applyDefinition replaces the definition of a process, restarting it with the
+// new one when it is running
+func (pm *ProcessManager) applyDefinition(procConfig *config.ProcessConfig) (bool, error) {
+	proc, err := pm.GetProcess(procConfig.Name)
+	if err != nil {
+		// Not running, the new definition is used on its next start
+		err := pm.store.UpdateProcess(procConfig.Name, func(procState *ProcessState) {
+			procState.Config = procConfig
+		})
+		return false, err
+	}
+
+	logrus.Infof("Definition of process %s changed, restarting it", procConfig.Name)
+	pm.events.Publish(Event{Type: EventRestarting, Process: procConfig.Name, Reason: "config changed"})
+	if err := pm.StopProcess(proc.Config.Name, false); err != nil {
+		return true, err
+	}
+
+	if _, err := pm.StartProcess(procConfig); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// removeDefinition stops a process whose definition file was removed and
+// forgets it
+func (pm *ProcessManager) removeDefinition(name string) {
+	if _, err := pm.GetProcess(name); err == nil {
+		logrus.Infof("Definition of process %s was removed, stopping it", name)
+		if err := pm.StopProcess(name, false); err != nil {
+			logrus.Warnf("Failed to stop process %s: %v", name, err)
+		}
+	}
+
+	if err := pm.store.DeleteProcess(name); err != nil {
+		logrus.Warnf("Failed to remove process %s from the state store: %v", name, err)
+	}
+}
+
+// sameDefinition reports whether two definitions of a process are equivalent,
+// treating the default log files as if they were set explicitly
+func sameDefinition(a, b *config.ProcessConfig, logsPath string) bool {
+	return definitionKey(a, logsPath) == definitionKey(b, logsPath)
+}
+
+// definitionKey returns a canonical encoding of a definition
+func definitionKey(procConfig *config.ProcessConfig, logsPath string) string {
+	normalized := *procConfig
+	if normalized.Log.Stdout == "" {
+		normalized.Log.Stdout = filepath.Join(logsPath, fmt.Sprintf("%s.out.log", normalized.Name))
+	}
+	if normalized.Log.Stderr == "" {
+		normalized.Log.Stderr = filepath.Join(logsPath, fmt.Sprintf("%s.err.log", normalized.Name))
+	}
+	if normalized.Type == "" {
+		normalized.Type = "simple"
+	}
+	if len(normalized.Args) == 0 {
+		normalized.Args = nil
+	}
+	if len(normalized.Environment) == 0 {
+		normalized.Environment = nil
+	}
+
+	data, _ := json.Marshal(normalized)
+	return string(data)
+}
+
+// sortReloadResult sorts every list in a reload result
+func sortReloadResult(result *ReloadResult) {
+	for _, list := range [][]string{result.Settings, result.RestartRequired, result.Unchanged, result.Restarted, result.Updated, result.Started, result.Removed} {
+		sort.Strings(list)
+	}
+}
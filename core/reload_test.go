@@ -0,0 +1,88 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prism/gem/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadConfig(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	assert.NoError(t, config.LoadConfig(tempDir))
+	processesPath := config.GlobalConfig.ProcessesPath
+	assert.NoError(t, os.MkdirAll(processesPath, 0755))
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), processesPath)
+	assert.NoError(t, err)
+	pm := NewProcessManager(store, filepath.Join(tempDir, "logs"))
+
+	writeDefinition := func(name, args string) string {
+		file := filepath.Join(processesPath, name+".gem")
+		content := "name: " + name + "\ncmd: sleep\nargs: [\"" + args + "\"]\nrestart: \"no\"\n"
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+		return file
+	}
+
+	// Start two processes from their files
+	for _, name := range []string{"web", "cron"} {
+		procConfig, err := config.LoadProcessConfig(writeDefinition(name, "10"))
+		assert.NoError(t, err)
+		_, err = pm.StartProcess(procConfig)
+		assert.NoError(t, err)
+	}
+	web, err := pm.GetProcess("web")
+	assert.NoError(t, err)
+	webPID := web.PID
+
+	// Nothing changed
+	result, err := pm.ReloadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cron", "web"}, result.Unchanged)
+	assert.Empty(t, result.Restarted)
+
+	// Change web, remove cron, add worker and raise the log level
+	writeDefinition("web", "20")
+	assert.NoError(t, os.Remove(filepath.Join(processesPath, "cron.gem")))
+	writeDefinition("worker", "10")
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, "config.yaml"), []byte("log_level: debug\n"), 0644))
+
+	result, err = pm.ReloadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log_level"}, result.Settings)
+	assert.Equal(t, []string{"web"}, result.Restarted)
+	assert.Equal(t, []string{"cron"}, result.Removed)
+	assert.Equal(t, []string{"worker"}, result.Started)
+	assert.Empty(t, result.Failed)
+	assert.Equal(t, "debug", config.GlobalConfig.LogLevel)
+
+	web, err = pm.GetProcess("web")
+	assert.NoError(t, err)
+	assert.NotEqual(t, webPID, web.PID)
+	assert.Equal(t, []string{"20"}, web.Config.Args)
+
+	_, err = pm.GetProcess("cron")
+	assert.Error(t, err)
+	_, exists := store.Get("cron")
+	assert.False(t, exists)
+
+	// Paths keep their running values until the daemon restarts
+	socketPath := config.Current().SocketPath
+	content := "log_level: debug\nsocket_path: " + filepath.Join(tempDir, "other.sock") + "\nprocesses_path: " + tempDir + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, "config.yaml"), []byte(content), 0644))
+	result, err = pm.ReloadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"processes_path", "socket_path"}, result.RestartRequired)
+	assert.Equal(t, socketPath, config.Current().SocketPath)
+	assert.Equal(t, processesPath, config.Current().ProcessesPath)
+
+	// Clean up
+	assert.NoError(t, pm.StopProcess("web", true))
+	assert.NoError(t, pm.StopProcess("worker", true))
+}
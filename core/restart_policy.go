@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// defaultMinUptime is how long a process has to run for its exit not to count
+// as unstable, unless it sets min_uptime
+const defaultMinUptime = time.Second
+
+// validateExitPolicy checks the exit codes and signals a process lists
+func validateExitPolicy(procConfig *config.ProcessConfig) error {
+	lists := map[string][]int{
+		"success_exit_codes":    procConfig.SuccessExitCodes,
+		"restart_exit_codes":    procConfig.RestartExitCodes,
+		"no_restart_exit_codes": procConfig.NoRestartExitCodes,
+	}
+	for option, codes := range lists {
+		for _, code := range codes {
+			if code < 0 || code > 255 {
+				return fmt.Errorf("process %s: invalid exit code %d in %s", procConfig.Name, code, option)
+			}
+		}
+	}
+
+	for _, name := range procConfig.SuccessSignals {
+		if _, err := utils.ParseSignal(name); err != nil {
+			return fmt.Errorf("process %s: invalid success_signals: %v", procConfig.Name, err)
+		}
+	}
+	return nil
+}
+
+// cleanExit reports whether an exit counts as a success: exit code 0, one of
+// success_exit_codes or death by one of success_signals
+func cleanExit(procConfig *config.ProcessConfig, exit ExitRecord) bool {
+	if exit.Signal != "" {
+		for _, name := range procConfig.SuccessSignals {
+			if sig, err := utils.ParseSignal(name); err == nil && unix.SignalName(sig) == exit.Signal {
+				return true
+			}
+		}
+		return false
+	}
+
+	return exit.ExitCode == 0 || containsCode(procConfig.SuccessExitCodes, exit.ExitCode)
+}
+
+// restartWanted decides whether a process is restarted after an exit.
+// no_restart_exit_codes and restart_exit_codes take precedence over the
+// restart policy.
+func restartWanted(procConfig *config.ProcessConfig, exit ExitRecord, clean, completed bool) bool {
+	if exit.Signal == "" {
+		if containsCode(procConfig.NoRestartExitCodes, exit.ExitCode) {
+			return false
+		}
+		if containsCode(procConfig.RestartExitCodes, exit.ExitCode) {
+			return true
+		}
+	}
+
+	switch procConfig.Restart {
+	case "always":
+		return !completed
+	case "on-failure":
+		return !clean
+	default:
+		return false
+	}
+}
+
+// containsCode reports whether codes contains code
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// minUptime returns how long a process has to run for its exit not to count
+// toward its unstable restart budget
+func minUptime(procConfig *config.ProcessConfig) time.Duration {
+	if procConfig.MinUptime > 0 {
+		return time.Duration(procConfig.MinUptime) * time.Second
+	}
+	return defaultMinUptime
+}
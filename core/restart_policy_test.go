@@ -0,0 +1,48 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/prism/gem/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartPolicy(t *testing.T) {
+	procConfig := &config.ProcessConfig{
+		Name:               "worker",
+		Restart:            "on-failure",
+		SuccessExitCodes:   []int{75},
+		RestartExitCodes:   []int{0},
+		NoRestartExitCodes: []int{78},
+		SuccessSignals:     []string{"TERM"},
+	}
+	assert.NoError(t, validateExitPolicy(procConfig))
+
+	tests := []struct {
+		exit    ExitRecord
+		clean   bool
+		restart bool
+	}{
+		{ExitRecord{ExitCode: 0}, true, true}, // restart_exit_codes wins over a clean exit
+		{ExitRecord{ExitCode: 75}, true, false},
+		{ExitRecord{ExitCode: 1}, false, true},
+		{ExitRecord{ExitCode: 78}, false, false},
+		{ExitRecord{ExitCode: -1, Signal: "SIGTERM"}, true, false},
+		{ExitRecord{ExitCode: -1, Signal: "SIGKILL"}, false, true},
+		{ExitRecord{ExitCode: -1}, false, true}, // Unknown exit status
+	}
+	for _, test := range tests {
+		clean := cleanExit(procConfig, test.exit)
+		assert.Equal(t, test.clean, clean, "%+v", test.exit)
+		assert.Equal(t, test.restart, restartWanted(procConfig, test.exit, clean, false), "%+v", test.exit)
+	}
+
+	// always restarts clean exits too, except for the listed codes
+	procConfig.Restart = "always"
+	assert.True(t, restartWanted(procConfig, ExitRecord{ExitCode: 75}, true, false))
+	assert.False(t, restartWanted(procConfig, ExitRecord{ExitCode: 78}, false, false))
+
+	// Invalid lists are rejected
+	assert.Error(t, validateExitPolicy(&config.ProcessConfig{SuccessExitCodes: []int{256}}))
+	assert.Error(t, validateExitPolicy(&config.ProcessConfig{SuccessSignals: []string{"SIGNOPE"}}))
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+)
+
+// killWait is how long a process gets to exit after SIGKILL
+const killWait = 5 * time.Second
+
+// defaultKillTimeout is used when neither kill_timeout nor shutdown_timeout is set
+const defaultKillTimeout = 10 * time.Second
+
+// StopAll stops every process for a daemon shutdown. Processes are stopped one
+// at a time, those depending on others before their dependencies and otherwise
+// the most recently started first, so that anything started on top of another
+// process goes away before it. Each process gets its kill timeout to exit
+// before it is killed.
+func (pm *ProcessManager) StopAll() {
+	pm.mutex.Lock()
+	pm.closing = true
+	pm.mutex.Unlock()
+
+	// Processes still being spawned are stopped along with the others
+	pm.starts.Wait()
+
+	for _, proc := range pm.shutdownOrder() {
+		logrus.Infof("Stopping process %s", proc.Config.Name)
+		if err := pm.StopProcess(proc.Config.Name, false); err != nil {
+			logrus.Warnf("Failed to stop process %s: %v", proc.Config.Name, err)
+		}
+	}
+}
+
+// Detach prepares a daemon shutdown that leaves every process running. The
+// processes stay recorded as running and the next daemon adopts them.
+func (pm *ProcessManager) Detach() {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	pm.closing = true
+	logrus.Infof("Leaving %d processes running", len(pm.processes))
+}
+
+// shutdownOrder returns the top level processes, dependents before their
+// dependencies and most recently started first. Cluster workers are stopped
+// together with their master.
+func (pm *ProcessManager) shutdownOrder() []*ManagedProcess {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	workers := make(map[*ManagedProcess]bool)
+	for _, proc := range pm.processes {
+		for _, worker := range proc.ClusterProcs {
+			workers[worker] = true
+		}
+	}
+
+	processes := make([]*ManagedProcess, 0, len(pm.processes))
+	for _, proc := range pm.processes {
+		if !workers[proc] {
+			processes = append(processes, proc)
+		}
+	}
+
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].StartTime.After(processes[j].StartTime)
+	})
+	return dependentsFirst(processes)
+}
+
+// killTimeout returns how long a process gets to exit after its stop signal
+// before it is killed
+func killTimeout(procConfig *config.ProcessConfig) time.Duration {
+	if procConfig.KillTimeout > 0 {
+		return time.Duration(procConfig.KillTimeout) * time.Second
+	}
+	if timeout := config.Current().ShutdownTimeout; timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+	return defaultKillTimeout
+}
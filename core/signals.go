@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// stopSignal returns the signal a process is stopped with, SIGTERM unless it
+// sets stop_signal
+func stopSignal(procConfig *config.ProcessConfig) (syscall.Signal, error) {
+	return configuredSignal(procConfig, "stop_signal", procConfig.StopSignal, syscall.SIGTERM)
+}
+
+// reloadSignal returns the signal that makes a process reload its
+// configuration, SIGHUP unless it sets reload_signal
+func reloadSignal(procConfig *config.ProcessConfig) (syscall.Signal, error) {
+	return configuredSignal(procConfig, "reload_signal", procConfig.ReloadSignal, syscall.SIGHUP)
+}
+
+// configuredSignal parses the signal set in option, or returns def when it is unset
+func configuredSignal(procConfig *config.ProcessConfig, option, value string, def syscall.Signal) (syscall.Signal, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	sig, err := utils.ParseSignal(value)
+	if err != nil {
+		return 0, fmt.Errorf("process %s: invalid %s: %v", procConfig.Name, option, err)
+	}
+	return sig, nil
+}
+
+// setProcessGroup makes cmd the leader of a new process group, unless the
+// process opted out to manage its children itself
+func setProcessGroup(cmd *exec.Cmd, procConfig *config.ProcessConfig) {
+	if procConfig.NoProcessGroup {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalGroup sends sig to the process group a process leads, so the
+// children it started get it as well. A process without its own group only
+// gets the signal itself.
+func (proc *ManagedProcess) signalGroup(sig syscall.Signal) error {
+	proc.mu.RLock()
+	cmd, pid, fingerprint := proc.Cmd, proc.PID, proc.fingerprint
+	proc.mu.RUnlock()
+
+	if proc.Config.NoProcessGroup || !isGroupLeader(pid) {
+		return proc.signal(sig)
+	}
+
+	// Adopted processes are signalled by PID, as long as it is still theirs
+	if cmd == nil && !utils.IsProcessRunning(int32(pid), fingerprint) {
+		return fmt.Errorf("process %s is not running", proc.Config.Name)
+	}
+	return syscall.Kill(-pid, sig)
+}
+
+// isGroupLeader reports whether pid leads its own process group
+func isGroupLeader(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	pgid, err := unix.Getpgid(pid)
+	return err == nil && pgid == pid
+}
@@ -0,0 +1,354 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+)
+
+// stateSchemaVersion is the version of the state file layout written by this build
+const stateSchemaVersion = 1
+
+// maxExitHistory is the number of exits kept per process
+const maxExitHistory = 20
+
+// stateMigrations upgrade a decoded state file one version at a time, keyed
+// by the version they upgrade from
+var stateMigrations = map[int]func(raw map[string]interface{}) error{}
+
+// State is everything Gem persists about its processes
+type State struct {
+	Version   int                      `json:"version"`
+	Processes map[string]*ProcessState `json:"processes"`
+}
+
+// ProcessState holds the desired config and the runtime state of a process
+type ProcessState struct {
+	Config           *config.ProcessConfig     `json:"config"`
+	Cluster          string                    `json:"cluster,omitempty"` // Master name for cluster workers
+	Status           string                    `json:"status"`
+	PID              int                       `json:"pid,omitempty"`
+	Fingerprint      *utils.ProcessFingerprint `json:"fingerprint,omitempty"`
+	StartTime        time.Time                 `json:"start_time,omitempty"`
+	Restarts         int                       `json:"restarts"`
+	UnstableRestarts int                       `json:"unstable_restarts,omitempty"` // Restarts in a row that followed an exit within min_uptime
+	MemoryRestarts   int                       `json:"memory_restarts,omitempty"`   // Restarts for exceeding max_memory_restart, not counted in Restarts
+	Backoff          *utils.BackoffState       `json:"backoff,omitempty"`
+	ExitHistory      []ExitRecord              `json:"exit_history,omitempty"`
+}
+
+// ExitRecord describes one exit of a process
+type ExitRecord struct {
+	Time     time.Time `json:"time"`
+	PID      int       `json:"pid"`
+	ExitCode int       `json:"exit_code"` // -1 when killed by a signal or unknown
+	Signal   string    `json:"signal,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// StateStore persists State as a single JSON file with atomic, crash-safe writes
+type StateStore struct {
+	path  string
+	state *State
+	mutex sync.Mutex
+}
+
+// OpenStateStore opens the state file at path, creating it on first use. When
+// there is no state file yet, processes recorded in the old layout of .pid and
+// .gem files under legacyProcessesPath are migrated into it.
+func OpenStateStore(path string, legacyProcessesPath string) (*StateStore, error) {
+	store := &StateStore{path: path}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		store.state, err = decodeState(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state file %s: %v", path, err)
+		}
+		return store, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// First run with a state store, import the old layout
+	store.state, err = migrateLegacyLayout(legacyProcessesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate %s: %v", legacyProcessesPath, err)
+	}
+	if err := store.write(store.state); err != nil {
+		return nil, err
+	}
+
+	// The .pid files are only removed once the state file is safely on disk,
+	// the .gem files are the user's definitions and stay
+	if len(store.state.Processes) > 0 {
+		removeLegacyFiles(legacyProcessesPath)
+		logrus.Infof("Migrated %d processes from %s to %s", len(store.state.Processes), legacyProcessesPath, path)
+	}
+
+	return store, nil
+}
+
+// Get returns a copy of the stored state of a process
+func (s *StateStore) Get(name string) (*ProcessState, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	procState, exists := s.state.Processes[name]
+	if !exists {
+		return nil, false
+	}
+	return copyProcessState(procState), true
+}
+
+// List returns a copy of the stored state of every process
+func (s *StateStore) List() map[string]*ProcessState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	processes := make(map[string]*ProcessState, len(s.state.Processes))
+	for name, procState := range s.state.Processes {
+		processes[name] = copyProcessState(procState)
+	}
+	return processes
+}
+
+// Update applies fn to a copy of the state and persists the result. If fn
+// returns an error or the write fails, the stored state is left unchanged.
+func (s *StateStore) Update(fn func(state *State) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	next, err := decodeState(data)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(next); err != nil {
+		return err
+	}
+	if err := s.write(next); err != nil {
+		return err
+	}
+
+	s.state = next
+	return nil
+}
+
+// UpdateProcess applies fn to the stored state of a process, creating it if needed
+func (s *StateStore) UpdateProcess(name string, fn func(procState *ProcessState)) error {
+	return s.Update(func(state *State) error {
+		procState, exists := state.Processes[name]
+		if !exists {
+			procState = &ProcessState{Status: "stopped"}
+			state.Processes[name] = procState
+		}
+		fn(procState)
+		return nil
+	})
+}
+
+// DeleteProcess removes a process from the store
+func (s *StateStore) DeleteProcess(name string) error {
+	return s.Update(func(state *State) error {
+		delete(state.Processes, name)
+		return nil
+	})
+}
+
+// RecordExit appends an exit to the history of a process
+func (procState *ProcessState) RecordExit(record ExitRecord) {
+	procState.ExitHistory = append(procState.ExitHistory, record)
+	if len(procState.ExitHistory) > maxExitHistory {
+		procState.ExitHistory = procState.ExitHistory[len(procState.ExitHistory)-maxExitHistory:]
+	}
+}
+
+// write atomically replaces the state file: the new content is written and
+// synced to a temporary file which is then renamed over the old one
+func (s *StateStore) write(state *State) error {
+	state.Version = stateSchemaVersion
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// The state holds process environments, keep it private
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself survives a crash
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// decodeState decodes a state file, migrating it to the current schema version
+func decodeState(data []byte) (*State, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if v, ok := raw["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > stateSchemaVersion {
+		return nil, fmt.Errorf("state file version %d is newer than supported version %d", version, stateSchemaVersion)
+	}
+
+	// Apply migrations up to the current version
+	for ; version < stateSchemaVersion; version++ {
+		migrate, exists := stateMigrations[version]
+		if !exists {
+			return nil, fmt.Errorf("no migration from state file version %d", version)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, fmt.Errorf("migration from version %d failed: %v", version, err)
+		}
+		raw["version"] = version + 1
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(migrated, &state); err != nil {
+		return nil, err
+	}
+	if state.Processes == nil {
+		state.Processes = make(map[string]*ProcessState)
+	}
+
+	return &state, nil
+}
+
+// migrateLegacyLayout builds a State from the .gem and .pid files older
+// versions of Gem kept in the processes directory
+func migrateLegacyLayout(processesPath string) (*State, error) {
+	state := &State{
+		Version:   stateSchemaVersion,
+		Processes: make(map[string]*ProcessState),
+	}
+
+	files, err := os.ReadDir(processesPath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Only PIDs that still belong to their process are carried over
+	running, err := utils.GetRunningProcesses(processesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".gem") {
+			continue
+		}
+
+		name := strings.TrimSuffix(file.Name(), ".gem")
+		procConfig, err := config.LoadProcessConfig(filepath.Join(processesPath, file.Name()))
+		if err != nil {
+			logrus.Warnf("Skipping unreadable config for process %s: %v", name, err)
+			continue
+		}
+		// The file stays the definition of the process, reload reads it
+
+		procState := &ProcessState{
+			Config: procConfig,
+			Status: "stopped",
+		}
+
+		if pid, ok := running[name]; ok {
+			fingerprint, err := utils.GetProcessFingerprint(pid)
+			if err == nil {
+				procState.Status = "running"
+				procState.PID = int(pid)
+				procState.Fingerprint = fingerprint
+				procState.StartTime = time.UnixMilli(fingerprint.StartTime)
+			}
+		}
+
+		state.Processes[name] = procState
+	}
+
+	return state, nil
+}
+
+// removeLegacyFiles deletes the migrated .pid files
+func removeLegacyFiles(processesPath string) {
+	files, err := os.ReadDir(processesPath)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(file.Name(), ".pid") {
+			os.Remove(filepath.Join(processesPath, file.Name()))
+		}
+	}
+}
+
+// copyProcessState returns a deep copy of a process state
+func copyProcessState(procState *ProcessState) *ProcessState {
+	data, _ := json.Marshal(procState)
+	var copied ProcessState
+	json.Unmarshal(data, &copied)
+	return &copied
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prism/gem/config"
+	"github.com/prism/gem/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateStoreMigratesLegacyLayout(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-store-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Lay out processes the way older versions did
+	processesPath := filepath.Join(tempDir, "processes")
+	assert.NoError(t, os.MkdirAll(processesPath, 0755))
+
+	cmd := exec.Command("sleep", "10")
+	assert.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	assert.NoError(t, os.WriteFile(filepath.Join(processesPath, "running.gem"), []byte("name: running\ncmd: sleep\nargs: [\"10\"]\n"), 0644))
+	assert.NoError(t, utils.WritePIDFile(cmd.Process.Pid, "running", processesPath))
+	assert.NoError(t, os.WriteFile(filepath.Join(processesPath, "idle.gem"), []byte("name: idle\ncmd: true\n"), 0644))
+
+	// Open the store
+	statePath := filepath.Join(tempDir, "state.json")
+	store, err := OpenStateStore(statePath, processesPath)
+	assert.NoError(t, err)
+
+	running, ok := store.Get("running")
+	assert.True(t, ok)
+	assert.Equal(t, "running", running.Status)
+	assert.Equal(t, cmd.Process.Pid, running.PID)
+	assert.NotNil(t, running.Fingerprint)
+	assert.Equal(t, []string{"10"}, running.Config.Args)
+
+	idle, ok := store.Get("idle")
+	assert.True(t, ok)
+	assert.Equal(t, "stopped", idle.Status)
+	assert.Zero(t, idle.PID)
+
+	// The definitions stay where they are, only the .pid files are gone
+	assert.Equal(t, filepath.Join(processesPath, "idle.gem"), idle.Config.ConfigFile)
+	assert.FileExists(t, filepath.Join(processesPath, "running.gem"))
+	assert.FileExists(t, filepath.Join(processesPath, "idle.gem"))
+	assert.NoFileExists(t, filepath.Join(processesPath, "running.pid"))
+
+	// The state file is private
+
+	info, err := os.Stat(statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestStateStoreUpdate(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-store-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	statePath := filepath.Join(tempDir, "state.json")
+	store, err := OpenStateStore(statePath, filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+
+	// Save a process
+	err = store.UpdateProcess("test", func(procState *ProcessState) {
+		procState.Config = &config.ProcessConfig{Name: "test", Command: "true", Environment: map[string]string{"KEY": "value"}}
+		procState.Restarts = 2
+	})
+	assert.NoError(t, err)
+
+	// A failed update leaves the state untouched
+	err = store.Update(func(state *State) error {
+		state.Processes["test"].Restarts = 100
+		return errors.New("abort")
+	})
+	assert.Error(t, err)
+
+	procState, _ := store.Get("test")
+	assert.Equal(t, 2, procState.Restarts)
+
+	// Copies handed out can't modify the store
+	procState.Restarts = 50
+	procState, _ = store.Get("test")
+	assert.Equal(t, 2, procState.Restarts)
+
+	// The state survives reopening
+	store, err = OpenStateStore(statePath, filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+
+	procState, ok := store.Get("test")
+	assert.True(t, ok)
+	assert.Equal(t, 2, procState.Restarts)
+	assert.Equal(t, "value", procState.Config.Environment["KEY"])
+}
+
+func TestStateStoreRejectsNewerVersion(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-store-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	statePath := filepath.Join(tempDir, "state.json")
+	assert.NoError(t, os.WriteFile(statePath, []byte(`{"version": 999, "processes": {}}`), 0600))
+
+	_, err = OpenStateStore(statePath, filepath.Join(tempDir, "processes"))
+	assert.Error(t, err)
+}
+
+func TestStateStoreRecordsExits(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-store-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	pm := NewProcessManager(store, filepath.Join(tempDir, "logs"))
+
+	// Start a process that fails
+	_, err = pm.StartProcess(&config.ProcessConfig{
+		Name:    "failing",
+		Command: "sh",
+		Args:    []string{"-c", "exit 3"},
+		Restart: "no",
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		procState, _ := store.Get("failing")
+		return procState.Status == "failed"
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// The exit is kept in the history while the definition stays in the store
+	procState, _ := store.Get("failing")
+	assert.Zero(t, procState.PID)
+	assert.Equal(t, "sh", procState.Config.Command)
+	assert.Len(t, procState.ExitHistory, 1)
+	assert.Equal(t, 3, procState.ExitHistory[0].ExitCode)
+	assert.Equal(t, "exited", procState.ExitHistory[0].Reason)
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prism/gem/config"
+)
+
+// watchdogReason is recorded for processes the watchdog killed
+const watchdogReason = "watchdog timeout"
+
+// validateWatchdog checks the watchdog_sec setting of a process
+func validateWatchdog(procConfig *config.ProcessConfig) error {
+	if procConfig.WatchdogSec < 0 {
+		return fmt.Errorf("watchdog_sec of process %s must not be negative", procConfig.Name)
+	}
+	if procConfig.WatchdogSec > 0 && procConfig.Type != "notify" {
+		return fmt.Errorf("process %s: watchdog_sec needs type notify", procConfig.Name)
+	}
+	return nil
+}
+
+// watchdogTimeout returns the time a process may go without a ping
+func watchdogTimeout(procConfig *config.ProcessConfig) time.Duration {
+	return time.Duration(procConfig.WatchdogSec) * time.Second
+}
+
+// startWatchdog starts expecting WATCHDOG=1 pings from a process that has a
+// watchdog
+func (pm *ProcessManager) startWatchdog(proc *ManagedProcess) {
+	if proc.Config.WatchdogSec <= 0 {
+		return
+	}
+
+	proc.mu.Lock()
+	proc.watchdog = make(chan bool, 1)
+	proc.mu.Unlock()
+
+	go pm.runWatchdog(proc)
+}
+
+// pingWatchdog passes a ping on to the watchdog of a process. A ping that
+// isn't healthy triggers the watchdog right away.
+func (proc *ManagedProcess) pingWatchdog(healthy bool) {
+	proc.mu.RLock()
+	watchdog := proc.watchdog
+	proc.mu.RUnlock()
+	if watchdog == nil {
+		return
+	}
+
+	select {
+	case watchdog <- healthy:
+	default:
+	}
+}
+
+// runWatchdog kills a process that misses a ping, until it exits. The monitor
+// restarts it.
+func (pm *ProcessManager) runWatchdog(proc *ManagedProcess) {
+	name := proc.Config.Name
+	timeout := watchdogTimeout(proc.Config)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-proc.done:
+			return
+		case healthy := <-proc.watchdog:
+			if healthy {
+				timer.Reset(timeout)
+				continue
+			}
+			logrus.Errorf("Process %s triggered its watchdog", name)
+		case <-timer.C:
+			logrus.Errorf("Process %s missed its watchdog ping for %s", name, timeout)
+		}
+
+		// A process that already exited or is being stopped is left alone
+		proc.mu.Lock()
+		if proc.stopping || (proc.Status != "running" && proc.Status != "starting") {
+			proc.mu.Unlock()
+			return
+		}
+		proc.killReason = watchdogReason
+		proc.mu.Unlock()
+
+		if err := proc.signalGroup(syscall.SIGKILL); err != nil {
+			logrus.Warnf("Failed to kill process %s: %v", name, err)
+		}
+		return
+	}
+}
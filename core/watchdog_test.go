@@ -0,0 +1,86 @@
+package core
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prism/gem/config"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdog(t *testing.T) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "gem-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	store, err := OpenStateStore(filepath.Join(tempDir, "state.json"), filepath.Join(tempDir, "processes"))
+	assert.NoError(t, err)
+	logsPath := filepath.Join(tempDir, "logs")
+
+	// Create process manager
+	pm := NewProcessManager(store, logsPath)
+	sub := pm.Events().Subscribe(0)
+	defer sub.Close()
+
+	// Only notify services can have a watchdog
+	_, err = pm.StartProcess(&config.ProcessConfig{Name: "plain", Command: "sleep", Args: []string{"30"}, WatchdogSec: 1})
+	assert.Error(t, err)
+
+	procConfig := &config.ProcessConfig{
+		Name:        "hung",
+		Command:     "sleep",
+		Args:        []string{"30"},
+		Type:        "notify",
+		Restart:     "no",
+		WatchdogSec: 1,
+	}
+	proc, err := pm.StartProcess(procConfig)
+	assert.NoError(t, err)
+	pid := proc.PID
+
+	p, err := process.NewProcess(int32(pid))
+	assert.NoError(t, err)
+	environ, err := p.Environ()
+	assert.NoError(t, err)
+	assert.Contains(t, environ, "WATCHDOG_USEC=1000000")
+
+	// Pings keep it alive past the timeout
+	socketPath := pm.notifySocketPath("hung")
+	for i := 0; i < 5; i++ {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+		assert.NoError(t, err)
+		_, err = conn.Write([]byte("WATCHDOG=1"))
+		assert.NoError(t, err)
+		conn.Close()
+		time.Sleep(400 * time.Millisecond)
+	}
+	current, err := pm.GetProcess("hung")
+	assert.NoError(t, err)
+	assert.Equal(t, pid, current.PID)
+
+	// Without them it is killed and restarted, whatever its restart policy
+	var restarting Event
+	timeout := time.After(5 * time.Second)
+	for restarting.Type != EventRestarting {
+		select {
+		case restarting = <-sub.Events():
+		case <-timeout:
+			t.Fatal("process was not restarted")
+		}
+	}
+	assert.Equal(t, "watchdog timeout", restarting.Reason)
+	assert.True(t, hasExited(int32(pid)))
+
+	procState, _ := store.Get("hung")
+	assert.Equal(t, 1, procState.Restarts)
+	last := procState.ExitHistory[len(procState.ExitHistory)-1]
+	assert.Equal(t, "watchdog timeout", last.Reason)
+	assert.Equal(t, "SIGKILL", last.Signal)
+
+	assert.NoError(t, pm.StopProcess("hung", false))
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessFingerprint identifies a process beyond its PID, which the kernel reuses
+type ProcessFingerprint struct {
+	StartTime   int64  `json:"start_time"`            // Kernel start time in milliseconds since the epoch
+	StartTicks  uint64 `json:"start_ticks,omitempty"` // Start time in clock ticks since boot, on Linux
+	Executable  string `json:"exe,omitempty"`
+	CmdlineHash string `json:"cmdline_hash,omitempty"`
+}
+
+// GetProcessFingerprint reads the fingerprint of a running process
+func GetProcessFingerprint(pid int32) (*ProcessFingerprint, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	createTime, err := proc.CreateTime()
+	if err != nil {
+		return nil, err
+	}
+
+	fp := &ProcessFingerprint{StartTime: createTime}
+
+	// The start time above is derived from the boot time, which moves with
+	// the wall clock, the ticks since boot don't
+	if ticks, err := processStartTicks(pid); err == nil {
+		fp.StartTicks = ticks
+	}
+
+	// The executable and command line may not be readable for other users' processes
+	if exe, err := proc.Exe(); err == nil {
+		fp.Executable = strings.TrimSuffix(exe, " (deleted)")
+	}
+	if cmdline, err := proc.CmdlineSlice(); err == nil {
+		fp.CmdlineHash = hashCmdline(cmdline)
+	}
+
+	return fp, nil
+}
+
+// Matches reports whether other describes the same process. Fields that were
+// not recorded are ignored, fields that can no longer be read are a mismatch.
+// The start time is compared in ticks when they were recorded.
+func (fp *ProcessFingerprint) Matches(other *ProcessFingerprint) bool {
+	if other == nil {
+		return false
+	}
+	if fp.StartTicks != 0 {
+		if fp.StartTicks != other.StartTicks {
+			return false
+		}
+	} else if fp.StartTime != other.StartTime {
+		return false
+	}
+	if fp.Executable != "" && fp.Executable != other.Executable {
+		return false
+	}
+	if fp.CmdlineHash != "" && fp.CmdlineHash != other.CmdlineHash {
+		return false
+	}
+	return true
+}
+
+// String encodes the fingerprint as the key=value lines stored in PID files
+func (fp *ProcessFingerprint) String() string {
+	return fmt.Sprintf("start_time=%d\nstart_ticks=%d\nexe=%s\ncmdline_hash=%s\n", fp.StartTime, fp.StartTicks, fp.Executable, fp.CmdlineHash)
+}
+
+// parseFingerprint decodes the key=value lines written by String
+func parseFingerprint(lines []string) (*ProcessFingerprint, error) {
+	fp := &ProcessFingerprint{}
+	for _, line := range lines {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "start_time":
+			startTime, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start_time: %v", err)
+			}
+			fp.StartTime = startTime
+		case "start_ticks":
+			startTicks, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start_ticks: %v", err)
+			}
+			fp.StartTicks = startTicks
+		case "exe":
+			fp.Executable = value
+		case "cmdline_hash":
+			fp.CmdlineHash = value
+		}
+	}
+
+	if fp.StartTime == 0 {
+		return nil, fmt.Errorf("missing start_time")
+	}
+	return fp, nil
+}
+
+// hashCmdline hashes a command line so it can be compared without storing it
+func hashCmdline(cmdline []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(cmdline, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package utils
+
+import "errors"
+
+// processStartTicks is only supported on Linux
+func processStartTicks(pid int32) (uint64, error) {
+	return 0, errors.New("start ticks are only available on Linux")
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// LockFile is an exclusive lock on a file, held until released or until the
+// process exits
+type LockFile struct {
+	file *os.File
+}
+
+// AcquireLock takes an exclusive lock on path without waiting and records the
+// current PID in it. It fails if another process holds the lock.
+func AcquireLock(path string) (*LockFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			if pid := readLockPID(path); pid > 0 {
+				return nil, fmt.Errorf("%s is locked by process %d", path, pid)
+			}
+			return nil, fmt.Errorf("%s is locked by another process", path)
+		}
+		return nil, err
+	}
+
+	// Record the holder for the error message other processes get
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &LockFile{file: file}, nil
+}
+
+// Release drops the lock. The file itself is left in place, removing it could
+// race with another process that has just opened it.
+func (l *LockFile) Release() error {
+	l.file.Truncate(0)
+	return l.file.Close()
+}
+
+// readLockPID returns the PID recorded in a lock file, or 0
+func readLockPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireLock(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-lock-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	lockPath := filepath.Join(tempDir, "gem.lock")
+	lock, err := AcquireLock(lockPath)
+	assert.NoError(t, err)
+
+	// A second holder is refused and told who has it
+	_, err = AcquireLock(lockPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "locked by process")
+
+	// Once released the lock can be taken again
+	assert.NoError(t, lock.Release())
+	lock, err = AcquireLock(lockPath)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Release())
+}
@@ -9,22 +9,73 @@ import (
 	"time"
 
 	"github.com/shirou/gopsutil/v3/process"
+	"github.com/sirupsen/logrus"
 )
 
 // ProcessInfo represents information about a running process
 type ProcessInfo struct {
-	PID        int32     `json:"pid"`
-	Name       string    `json:"name"`
-	Status     string    `json:"status"`
-	CPU        float64   `json:"cpu"`
-	Memory     float64   `json:"memory"`
-	StartTime  time.Time `json:"start_time"`
-	Uptime     string    `json:"uptime"`
-	Command    string    `json:"command"`
-	Restarts   int       `json:"restarts"`
-	User       string    `json:"user"`
-	ClusterID  int       `json:"cluster_id,omitempty"`
-	Instances  int       `json:"instances,omitempty"`
+	PID            int32             `json:"pid"`
+	Name           string            `json:"name"`
+	Status         string            `json:"status"`
+	StatusText     string            `json:"status_text,omitempty"` // STATUS a notify service reported
+	CPU            float64           `json:"cpu"`
+	Memory         float64           `json:"memory"`
+	StartTime      time.Time         `json:"start_time"`
+	Uptime         string            `json:"uptime"`
+	Command        string            `json:"command"`
+	Restarts       int               `json:"restarts"`
+	MemoryRestarts int               `json:"memory_restarts,omitempty"`  // Restarts for exceeding max_memory_restart
+	LastExitReason string            `json:"last_exit_reason,omitempty"` // Why the process last exited, e.g. "oom killed"
+	User           string            `json:"user"`
+	Cgroup         string            `json:"cgroup,omitempty"` // cgroup v2 the process runs in
+	ClusterID      int               `json:"cluster_id,omitempty"`
+	Instances      int               `json:"instances,omitempty"`
+	ClusterMode    string            `json:"cluster_mode,omitempty"`
+	Environment    map[string]string `json:"environment,omitempty"`
+	Workers        []*ProcessInfo    `json:"workers,omitempty"`
+	Descendants    []int32           `json:"descendants,omitempty"`
+	Backoff        *BackoffState     `json:"backoff,omitempty"`
+	Health         *HealthState      `json:"health,omitempty"`
+	DependsOn      []DependencyInfo  `json:"depends_on,omitempty"`
+	RequiredBy     []string          `json:"required_by,omitempty"` // Processes that depend on this one
+}
+
+// HealthState describes the outcome of the health checks of a process
+type HealthState struct {
+	Status    string    `json:"status"`   // "starting", "healthy" or "unhealthy"
+	Failures  int       `json:"failures"` // Failed checks in a row
+	LastCheck time.Time `json:"last_check,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// DependencyInfo describes a dependency of a process and its own dependencies
+type DependencyInfo struct {
+	Name      string           `json:"name"`
+	Condition string           `json:"condition"` // "started", "healthy" or "completed"
+	Status    string           `json:"status"`
+	Met       bool             `json:"met"`
+	DependsOn []DependencyInfo `json:"depends_on,omitempty"`
+}
+
+// BackoffState describes where a crash-looping process is in its restart backoff
+type BackoffState struct {
+	Attempt     int           `json:"attempt"`                // Restarts since the delay was last reset
+	Delay       time.Duration `json:"delay"`                  // Delay before the latest restart
+	NextRestart time.Time     `json:"next_restart,omitempty"` // Set while a restart is pending
+}
+
+// GetProcessRSS returns the resident memory of a process in bytes
+func GetProcessRSS(pid int32) (uint64, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	memInfo, err := proc.MemoryInfo()
+	if err != nil {
+		return 0, err
+	}
+	return memInfo.RSS, nil
 }
 
 // GetProcessInfo retrieves information about a process by PID
@@ -88,32 +139,75 @@ func GetProcessInfo(pid int32) (*ProcessInfo, error) {
 	}, nil
 }
 
-// IsProcessRunning checks if a process with the given PID is running
-func IsProcessRunning(pid int32) bool {
-	_, err := process.NewProcess(pid)
-	return err == nil
+// GetProcessStartTime returns the time the kernel started a process
+func GetProcessStartTime(pid int32) (time.Time, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	createTime, err := proc.CreateTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.UnixMilli(createTime), nil
+}
+
+// IsProcessRunning checks if a process with the given PID is running. When a
+// fingerprint is given, the process must also match it, so a PID that was
+// reused by an unrelated process doesn't count.
+func IsProcessRunning(pid int32, fp *ProcessFingerprint) bool {
+	if _, err := process.NewProcess(pid); err != nil {
+		return false
+	}
+	if fp == nil {
+		return true
+	}
+
+	current, err := GetProcessFingerprint(pid)
+	if err != nil {
+		return false
+	}
+	return fp.Matches(current)
 }
 
-// WritePIDFile writes a PID to a file
+// WritePIDFile writes a PID and the fingerprint of its process to a file
 func WritePIDFile(pid int, name string, processesDir string) error {
+	content := strconv.Itoa(pid) + "\n"
+	if fp, err := GetProcessFingerprint(int32(pid)); err == nil {
+		content += fp.String()
+	}
+
 	pidFile := filepath.Join(processesDir, fmt.Sprintf("%s.pid", name))
-	return os.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0644)
+	return os.WriteFile(pidFile, []byte(content), 0644)
 }
 
-// ReadPIDFile reads a PID from a file
-func ReadPIDFile(name string, processesDir string) (int32, error) {
+// ReadPIDFile reads a PID and its fingerprint from a file. Files written by
+// older versions of Gem have no fingerprint, in which case it is nil.
+func ReadPIDFile(name string, processesDir string) (int32, *ProcessFingerprint, error) {
 	pidFile := filepath.Join(processesDir, fmt.Sprintf("%s.pid", name))
 	data, err := os.ReadFile(pidFile)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
-	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
 	if err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+
+	if len(lines) == 1 {
+		return int32(pid), nil, nil
+	}
+
+	fp, err := parseFingerprint(lines[1:])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid PID file %s: %v", pidFile, err)
 	}
 
-	return int32(pid), nil
+	return int32(pid), fp, nil
 }
 
 // DeletePIDFile deletes a PID file
@@ -134,20 +228,47 @@ func GetRunningProcesses(processesDir string) (map[string]int32, error) {
 	for _, file := range files {
 		if !file.IsDir() && strings.HasSuffix(file.Name(), ".pid") {
 			name := strings.TrimSuffix(file.Name(), ".pid")
-			pid, err := ReadPIDFile(name, processesDir)
+			pid, fp, err := ReadPIDFile(name, processesDir)
 			if err != nil {
 				continue
 			}
 
-			if IsProcessRunning(pid) {
-				processes[name] = pid
-			} else {
+			if !IsProcessRunning(pid, nil) {
 				// Clean up stale PID file
 				DeletePIDFile(name, processesDir)
+				continue
 			}
+
+			if !isSameProcess(pid, fp, filepath.Join(processesDir, file.Name())) {
+				// The PID was reused, never adopt the unrelated process
+				logrus.Warnf("Stale PID file for %s: PID %d now belongs to another process", name, pid)
+				DeletePIDFile(name, processesDir)
+				continue
+			}
+
+			processes[name] = pid
 		}
 	}
 
 	return processes, nil
 }
 
+// isSameProcess checks that a live PID still belongs to the process recorded
+// in its PID file
+func isSameProcess(pid int32, fp *ProcessFingerprint, pidFile string) bool {
+	if fp != nil {
+		return IsProcessRunning(pid, fp)
+	}
+
+	// Legacy PID files have no fingerprint, but a process started after the
+	// file was written can't be the one it describes
+	info, err := os.Stat(pidFile)
+	if err != nil {
+		return false
+	}
+	startTime, err := GetProcessStartTime(pid)
+	if err != nil {
+		return false
+	}
+	return !startTime.After(info.ModTime())
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPIDFileFingerprint(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-pid-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Start a process to fingerprint
+	cmd := exec.Command("sleep", "10")
+	assert.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	// Write and read back the PID file
+	err = WritePIDFile(cmd.Process.Pid, "test", tempDir)
+	assert.NoError(t, err)
+
+	pid, fp, err := ReadPIDFile("test", tempDir)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(cmd.Process.Pid), pid)
+	assert.NotNil(t, fp)
+	assert.NotZero(t, fp.StartTime)
+	assert.NotEmpty(t, fp.CmdlineHash)
+
+	// The fingerprint matches the live process
+	assert.True(t, IsProcessRunning(pid, fp))
+
+	// Any difference means the PID belongs to someone else
+	other := *fp
+	other.StartTicks++
+	assert.False(t, IsProcessRunning(pid, &other))
+	other = *fp
+	other.CmdlineHash = "0000"
+	assert.False(t, IsProcessRunning(pid, &other))
+
+	// The start time is only compared without ticks, it moves with the clock
+	other = *fp
+	other.StartTime++
+	assert.Equal(t, fp.StartTicks != 0, IsProcessRunning(pid, &other))
+}
+
+func TestGetRunningProcessesSkipsReusedPID(t *testing.T) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "gem-pid-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Start a process to fingerprint
+	cmd := exec.Command("sleep", "10")
+	assert.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	// A valid PID file is reported as running
+	assert.NoError(t, WritePIDFile(cmd.Process.Pid, "ours", tempDir))
+
+	// A PID file whose fingerprint doesn't match the live process is stale
+	stale := filepath.Join(tempDir, "reused.pid")
+	assert.NoError(t, os.WriteFile(stale, []byte(
+		"1\nstart_time=1\nexe=/nonexistent\ncmdline_hash=0000\n"), 0644))
+
+	// A legacy PID file written before its process started is stale too
+	legacy := filepath.Join(tempDir, "legacy.pid")
+	assert.NoError(t, os.WriteFile(legacy, []byte("1"), 0644))
+	past := time.Now().Add(-100 * 365 * 24 * time.Hour)
+	assert.NoError(t, os.Chtimes(legacy, past, past))
+
+	processes, err := GetRunningProcesses(tempDir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int32{"ours": int32(cmd.Process.Pid)}, processes)
+
+	// Stale files are cleaned up
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(legacy)
+	assert.True(t, os.IsNotExist(err))
+}
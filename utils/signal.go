@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ParseSignal parses a signal given by name, with or without the SIG prefix
+// and in any case, or by number
+func ParseSignal(name string) (syscall.Signal, error) {
+	if num, err := strconv.Atoi(name); err == nil {
+		if num <= 0 || num > 64 {
+			return 0, fmt.Errorf("invalid signal number %d", num)
+		}
+		return syscall.Signal(num), nil
+	}
+
+	upper := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(upper, "SIG") {
+		upper = "SIG" + upper
+	}
+	sig := unix.SignalNum(upper)
+	if sig == 0 {
+		return 0, fmt.Errorf("unknown signal %q", name)
+	}
+	return sig, nil
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"SIGINT", "INT", "int", "2"} {
+		sig, err := ParseSignal(name)
+		assert.NoError(t, err)
+		assert.Equal(t, syscall.SIGINT, sig)
+	}
+
+	sig, err := ParseSignal("sigquit")
+	assert.NoError(t, err)
+	assert.Equal(t, syscall.SIGQUIT, sig)
+
+	_, err = ParseSignal("SIGNOPE")
+	assert.Error(t, err)
+	_, err = ParseSignal("0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the multipliers of the size suffixes, in powers of 1024
+var sizeUnits = map[string]uint64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize parses a size in bytes like "512M", "1.5G" or "1024", with an
+// optional B or iB after the unit and in any case
+func ParseSize(size string) (uint64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(size))
+	upper = strings.TrimSuffix(strings.TrimSuffix(upper, "IB"), "B")
+
+	number := strings.TrimRight(upper, "KMGT")
+	unit := upper[len(number):]
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return uint64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]uint64{
+		"1024":  1024,
+		"512M":  512 << 20,
+		"512MB": 512 << 20,
+		"1.5G":  3 << 29,
+		"2GiB":  2 << 30,
+		"64k":   64 << 10,
+		"10B":   10,
+	}
+	for size, expected := range sizes {
+		parsed, err := ParseSize(size)
+		assert.NoError(t, err, size)
+		assert.Equal(t, expected, parsed, size)
+	}
+
+	for _, size := range []string{"", "M", "lots", "-1G", "5X", "512mi"} {
+		_, err := ParseSize(size)
+		assert.Error(t, err, size)
+	}
+}
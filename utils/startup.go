@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// StartupOptions describes the service an init script is generated for
+type StartupOptions struct {
+	Name      string // Service name
+	User      string // User the daemon runs as
+	Binary    string // Absolute path of the gem binary
+	ConfigDir string // Config directory passed to the daemon
+}
+
+// initSystem describes how Gem integrates with one init system
+type initSystem struct {
+	dir         string      // Where services are installed
+	suffix      string      // File name suffix of a service
+	mode        os.FileMode // File mode of the installed file
+	template    string
+	enable      func(name string) [][]string
+	disable     func(name string) [][]string
+	afterRemove [][]string // Commands to run once a service file is removed
+}
+
+var initSystems = map[string]initSystem{
+	"systemd": {
+		dir:      "/etc/systemd/system",
+		suffix:   ".service",
+		mode:     0644,
+		template: systemdTemplate,
+		enable: func(name string) [][]string {
+			return [][]string{{"systemctl", "daemon-reload"}, {"systemctl", "enable", name}}
+		},
+		disable: func(name string) [][]string {
+			return [][]string{{"systemctl", "disable", name}}
+		},
+		afterRemove: [][]string{{"systemctl", "daemon-reload"}},
+	},
+	"openrc": {
+		dir:      "/etc/init.d",
+		mode:     0755,
+		template: openrcTemplate,
+		enable: func(name string) [][]string {
+			return [][]string{{"rc-update", "add", name, "default"}}
+		},
+		disable: func(name string) [][]string {
+			return [][]string{{"rc-update", "del", name, "default"}}
+		},
+	},
+	"sysv": {
+		dir:      "/etc/init.d",
+		mode:     0755,
+		template: sysvTemplate,
+		enable: func(name string) [][]string {
+			return [][]string{{"update-rc.d", name, "defaults"}}
+		},
+		disable: func(name string) [][]string {
+			return [][]string{{"update-rc.d", "-f", name, "remove"}}
+		},
+	},
+}
+
+// StartupInitSystems returns the supported init systems
+func StartupInitSystems() []string {
+	return []string{"systemd", "openrc", "sysv"}
+}
+
+// GenerateStartupScript renders the service definition for an init system
+func GenerateStartupScript(system string, opts StartupOptions) (string, error) {
+	sys, err := lookupInitSystem(system)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(system).Funcs(template.FuncMap{"quote": shellQuote}).Parse(sys.template)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, opts); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// StartupScriptPath returns where the service file is placed inside dir. An
+// empty dir means the init system's own directory.
+func StartupScriptPath(system, dir, name string) (string, error) {
+	sys, err := lookupInitSystem(system)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		dir = sys.dir
+	}
+	return filepath.Join(dir, name+sys.suffix), nil
+}
+
+// StartupScriptMode returns the file mode for a service file
+func StartupScriptMode(system string) os.FileMode {
+	return initSystems[system].mode
+}
+
+// StartupEnableCommands returns the commands that enable an installed service
+func StartupEnableCommands(system, name string) [][]string {
+	return initSystems[system].enable(name)
+}
+
+// StartupDisableCommands returns the commands that disable an installed
+// service before its file is removed, and those to run after removal
+func StartupDisableCommands(system, name string) (before [][]string, after [][]string) {
+	sys := initSystems[system]
+	return sys.disable(name), sys.afterRemove
+}
+
+// lookupInitSystem returns the integration for a supported init system
+func lookupInitSystem(system string) (initSystem, error) {
+	sys, exists := initSystems[system]
+	if !exists {
+		return initSystem{}, fmt.Errorf("unsupported init system %q (supported: %s)", system, strings.Join(StartupInitSystems(), ", "))
+	}
+	return sys, nil
+}
+
+// shellQuote quotes a string for use in shell scripts and unit files
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+const systemdTemplate = `[Unit]
+Description=Gem process manager for {{.User}}
+Documentation=https://github.com/prismmanager/gem
+After=network.target
+
+[Service]
+Type=simple
+User={{.User}}
+ExecStart={{quote .Binary}} daemon --config-dir {{quote .ConfigDir}}
+Restart=on-failure
+# Only signal the daemon, it decides what happens to its processes
+KillMode=process
+# The daemon runs every process in a cgroup of its own below this one
+Delegate=yes
+LimitNOFILE=infinity
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const openrcTemplate = `#!/sbin/openrc-run
+
+name={{quote .Name}}
+description="Gem process manager for {{.User}}"
+command={{quote .Binary}}
+command_args="daemon --config-dir {{quote .ConfigDir}}"
+command_user={{quote .User}}
+command_background=true
+pidfile="/run/${RC_SVCNAME}.pid"
+
+depend() {
+	need net
+	after firewall
+}
+`
+
+const sysvTemplate = `#!/bin/sh
+### BEGIN INIT INFO
+# Provides:          {{.Name}}
+# Required-Start:    $local_fs $remote_fs $network
+# Required-Stop:     $local_fs $remote_fs $network
+# Default-Start:     2 3 4 5
+# Default-Stop:      0 1 6
+# Short-Description: Gem process manager for {{.User}}
+### END INIT INFO
+
+NAME={{quote .Name}}
+USER={{quote .User}}
+DAEMON={{quote .Binary}}
+CONFIG_DIR={{quote .ConfigDir}}
+PIDFILE="/var/run/$NAME.pid"
+
+start() {
+	start-stop-daemon --start --quiet --background --make-pidfile --pidfile "$PIDFILE" \
+		--chuid "$USER" --exec "$DAEMON" -- daemon --config-dir "$CONFIG_DIR"
+}
+
+stop() {
+	start-stop-daemon --stop --quiet --pidfile "$PIDFILE" --retry TERM/30/KILL/5
+	rm -f "$PIDFILE"
+}
+
+case "$1" in
+	start)
+		start
+		;;
+	stop)
+		stop
+		;;
+	restart)
+		stop
+		start
+		;;
+	status)
+		start-stop-daemon --status --pidfile "$PIDFILE"
+		;;
+	*)
+		echo "Usage: $0 {start|stop|restart|status}"
+		exit 1
+		;;
+esac
+`
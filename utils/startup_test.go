@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateStartupScript(t *testing.T) {
+	opts := StartupOptions{
+		Name:      "gem-deploy",
+		User:      "deploy",
+		Binary:    "/usr/local/bin/gem",
+		ConfigDir: "/home/deploy/.gem",
+	}
+
+	// Every init system runs the daemon as the user with its config dir
+	for _, system := range StartupInitSystems() {
+		script, err := GenerateStartupScript(system, opts)
+		assert.NoError(t, err, system)
+		assert.Contains(t, script, "deploy", system)
+		assert.Contains(t, script, "'/usr/local/bin/gem'", system)
+		assert.Contains(t, script, "'/home/deploy/.gem'", system)
+	}
+
+	script, err := GenerateStartupScript("systemd", opts)
+	assert.NoError(t, err)
+	assert.Contains(t, script, "User=deploy")
+	assert.Contains(t, script, "ExecStart='/usr/local/bin/gem' daemon --config-dir '/home/deploy/.gem'")
+	assert.Contains(t, script, "Delegate=yes")
+
+	// Unknown init systems are rejected
+	_, err = GenerateStartupScript("upstart", opts)
+	assert.Error(t, err)
+}
+
+func TestStartupScriptPath(t *testing.T) {
+	path, err := StartupScriptPath("systemd", "", "gem-deploy")
+	assert.NoError(t, err)
+	assert.Equal(t, "/etc/systemd/system/gem-deploy.service", path)
+
+	path, err = StartupScriptPath("openrc", "/tmp/out", "gem-deploy")
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/out/gem-deploy", path)
+
+	_, err = StartupScriptPath("upstart", "", "gem-deploy")
+	assert.Error(t, err)
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "'/opt/my app'", shellQuote("/opt/my app"))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}